@@ -1,12 +1,25 @@
 package cli
 
 import (
+	"bufio"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 )
 
+// OsExiter is the function used to terminate the process when an App exits
+// with an error. It can be replaced, e.g. to capture the exit code in tests.
+var OsExiter = os.Exit
+
 // App is the main structure of a cli application.
 // New App variables should be created with the cli.NewApp() function.
 type App struct {
@@ -17,6 +30,13 @@ type App struct {
 	// Description of the program.
 	Usage string
 
+	// Usage of the arguments of the default action, e.g. "<file>...". Adds a
+	// usage line for running the program without a command to the help
+	ArgsUsage string
+
+	// A longer explanation of what the program does when run without a command
+	Description string
+
 	// Version of the program
 	Version string
 
@@ -26,19 +46,82 @@ type App struct {
 	// List of flags to parse
 	Flags []Flag
 
-	// Boolean to enable bash completion commands
+	// Boolean to enable bash completion commands, and a hidden
+	// __complete-metadata command that prints the commands and flags as JSON
 	EnableBashCompletion bool
 
+	// Boolean to print to ErrWriter how completions are computed, to diagnose
+	// completion scripts
+	CompletionDebug bool
+
+	// Directory to cache the completions of commands with a
+	// CompletionCacheTTL in, defaults to <app name>/completion in os.UserCacheDir()
+	CompletionCacheDir string
+
+	// Boolean to accept both the camelCase and kebab-case spelling of flag names.
+	// The flags are then known by their kebab-case names, also in help and the
+	// lookups of the context
+	EnableFlagNameNormalization bool
+
+	// Boolean to match flag names case-insensitively, e.g. --Verbose to --verbose
+	CaseInsensitiveFlags bool
+
+	// Boolean to also parse global flags that are given after the command,
+	// unless the command has a flag of the same name
+	GlobalFlagsAnywhere bool
+
+	// Function to rewrite the arguments, without the program name, before they
+	// are parsed, e.g. to translate deprecated forms. Context.RawArgs still
+	// returns the original arguments
+	ArgsRewriter func(args []string) []string
+
+	// Groups of global flags of which exactly one must be set
+	RequireExactlyOne [][]string
+
+	// Global flags that require other global flags to be set when they are
+	// set, e.g. {"push": {"registry"}} for --push to require --registry
+	Implies map[string][]string
+
+	// Boolean to add a config command that shows the resolved global options
+	EnableConfigDumpCommand bool
+
 	// An action to execute when the bash-completion flag is set
 	BashComplete func(context *Context)
 
+	// Function to check the parsed global flags and arguments, after the
+	// built-in checks and before Before. If a non-nil error is returned, it is
+	// reported as a usage error and nothing is run
+	Validate func(context *Context) error
+
 	// An action to execute before any subcommands are run, but after the context is ready.
 	// If a non-nil error is returned, no subcommands are run.
 	Before func(context *Context) error
 
+	// An action to execute after any subcommands are run, but only if Before succeeded.
+	// Its error is returned if running the subcommands did not fail.
+	After func(context *Context) error
+
+	// Function to transform the arguments of the actions of the app and of all
+	// commands, before the PreprocessArgs function of the command is run
+	PreprocessArgs func(args []string) ([]string, error)
+
 	// The action to execute when no subcommands are specified
 	Action func(context *Context)
 
+	// A command that is run instead of Action when no command is given, with
+	// the arguments and the flags that are not global flags, e.g. "mytool
+	// --force file" for a root command with a --force flag. It is not listed
+	// among the commands, but can also be run by its Name, which must be set
+	RootCommand *Command
+
+	// Function to check if help is asked for, e.g. to also show help for
+	// --usage. Defaults to DefaultIsHelp
+	IsHelp func(context *Context) bool
+
+	// Function to check if the version is asked for. Defaults to
+	// DefaultIsVersion
+	IsVersion func(context *Context) bool
+
 	// Execute this function if the proper command cannot be found
 	CommandNotFound func(context *Context, command string)
 
@@ -50,6 +133,106 @@ type App struct {
 
 	// Author e-mail
 	Email string
+
+	// Text printed at the bottom of the help, e.g. to point to the documentation
+	HelpFooter string
+
+	// Boolean to show help that does not fit on the terminal in $PAGER, less
+	// or more. HelpPrinter is not used for help that is paged
+	EnableHelpPager bool
+
+	// Boolean to always show help with the usage of the commands and flags on
+	// the line below their names, as is done on terminals narrower than 60
+	// columns. HelpPrinter is not used for compact help
+	CompactHelp bool
+
+	// Reader used for the input of actions. Defaults to os.Stdin
+	Reader io.Reader
+
+	// Writer used for the output of actions. Defaults to os.Stdout
+	Writer io.Writer
+
+	// Writer used for errors and warnings. Defaults to os.Stderr
+	ErrWriter io.Writer
+
+	// Boolean to never wait for input from the user, e.g. when running in CI
+	BatchMode bool
+
+	// Function to translate the fixed strings printed by cli, given in English.
+	// An empty result keeps the English string. Help output is translated by
+	// replacing AppHelpTemplate, CommandHelpTemplate and SubcommandHelpTemplate.
+	Translator func(key string) string
+
+	// How errors are handled when parsing flags. Defaults to flag.ContinueOnError,
+	// which lets Run return the error
+	FlagErrorHandling flag.ErrorHandling
+
+	// Boolean to let LoadDotEnv overwrite variables that are already set in the environment
+	DotEnvOverride bool
+
+	// Boolean to prefix the errors returned by commands with the command path,
+	// e.g. "greet hello: flag provided but not defined: -x"
+	WrapActionErrors bool
+
+	// Boolean to add a --version-json flag that prints the version info as JSON
+	EnableVersionJSON bool
+
+	// Boolean to run the command named like the binary, after MultiCallPrefix,
+	// with all arguments, e.g. the ls command when the binary is a mytool-ls symlink
+	MultiCall bool
+
+	// Prefix of the binary name that is stripped before looking up the command
+	// in MultiCall mode, e.g. "mytool-"
+	MultiCallPrefix string
+
+	// Boolean to replace the values of string flags that start with "exec:" with
+	// the trimmed output of the command after it, e.g. --token exec:get-token.
+	// The command is run without a shell. Anyone who can pass arguments to the
+	// program can then run any command as the user running it, so only enable
+	// this for programs whose arguments come from the user themselves
+	EnableExecFlagValues bool
+
+	// Boolean to expand references like ${host} in the values of string flags
+	// to the values of the other flags of the app or command, e.g.
+	// --url "https://${host}:${port}/api"
+	EnableFlagInterpolation bool
+
+	// Writer to log the resolved flags of every invocation to, as one JSON
+	// object per line. The values of sensitive flags are replaced by ***
+	AuditWriter io.Writer
+
+	// Boolean to add an --output-file, -O flag that writes the output of the
+	// commands to the given file instead of Writer
+	EnableOutputFileFlag bool
+
+	// Boolean to add a --dry-run flag, see Context.DryRun and Context.Mutate
+	EnableDryRunFlag bool
+
+	// Boolean to add --cpuprofile and --memprofile flags that write pprof
+	// profiles of the run, including the Before and After hooks, to files
+	EnableProfilingFlags bool
+
+	// Boolean to buffer the output written to Writer, which is flushed when
+	// the action and the hooks are done, for commands with many small writes
+	BufferedOutput bool
+
+	// Flag defaults set by WithDefaults
+	defaults map[string]string
+
+	// Middlewares added by Use
+	middlewares []func(next ActionFunc) ActionFunc
+
+	// Resolvers added by RegisterValueResolver, by scheme
+	valueResolvers map[string]func(ref string) (string, error)
+
+	// Aliases added by AddAlias, with the arguments they expand to
+	aliases map[string][]string
+
+	// The buffer of the output, if BufferedOutput is set
+	buffer *bufio.Writer
+
+	// The context of the command the app is mounted as, see Mount
+	parent *Context
 }
 
 // compileTime tries to find out when this binary was compiled.
@@ -69,34 +252,64 @@ func NewApp() *App {
 		Usage:        "A new cli application",
 		Version:      "0.0.0",
 		BashComplete: DefaultAppComplete,
+		IsHelp:       DefaultIsHelp,
+		IsVersion:    DefaultIsVersion,
 		Action:       helpCommand.Action,
 		Compiled:     compileTime(),
 		Author:       "Author",
 		Email:        "unknown@email",
+		Reader:       os.Stdin,
+		Writer:       os.Stdout,
+		ErrWriter:    os.Stderr,
 	}
 }
 
 // Run provides an entry point to the cli app.
 // It parses the slice of arguments and routes to the proper flag/args combination.
 func (a *App) Run(arguments []string) error {
-
-	// append help to commands
-	if a.Command(helpCommand.Name) == nil {
-		a.Commands = append(a.Commands, helpCommand)
-	}
+	a.normalizeFlagNames()
+	a.appendCommands()
 
 	// append version/help flags
 	if a.EnableBashCompletion {
 		a.appendFlag(BashCompletionFlag)
 	}
-	a.appendFlag(BoolFlag{"version, v", "print the version"})
-	a.appendFlag(BoolFlag{"help, h", "show help"})
+	a.appendFlag(a.translateUsage(versionFlag))
+	if a.EnableVersionJSON {
+		a.appendFlag(a.translateUsage(versionJSONFlag))
+	}
+	if a.EnableOutputFileFlag {
+		a.appendFlag(a.translateUsage(outputFileFlag))
+	}
+	if a.EnableDryRunFlag {
+		a.appendFlag(a.translateUsage(dryRunFlag))
+	}
+	if a.EnableProfilingFlags {
+		a.appendFlag(a.translateUsage(cpuProfileFlag))
+		a.appendFlag(a.translateUsage(memProfileFlag))
+	}
+	a.appendFlag(a.translateUsage(helpFlag))
 
 	// parse flags
-	set := flagSet(a.Name, a.Flags)
-	set.SetOutput(ioutil.Discard)
-	err := set.Parse(arguments[1:])
+	set := a.newFlagSet(a.Name, a.Flags)
+	flagArgs := arguments[1:]
+	if a.MultiCall {
+		flagArgs = a.multiCallArgs(arguments[0], flagArgs)
+	}
+	if a.ArgsRewriter != nil {
+		flagArgs = a.ArgsRewriter(flagArgs)
+	}
+	if a.GlobalFlagsAnywhere {
+		flagArgs = a.hoistGlobalFlags(set, flagArgs)
+	}
+	if a.RootCommand != nil {
+		flagArgs = a.rootArgs(set, flagArgs)
+	}
+	err := set.Parse(a.normalizeArgs(set, flagArgs, true))
 	nerr := normalizeFlags(a.Flags, set)
+	if nerr == nil && err == nil {
+		nerr = a.resolveFlags(a.Flags, set)
+	}
 	if nerr != nil {
 		fmt.Println(nerr)
 		context := NewContext(a, set, set)
@@ -105,15 +318,59 @@ func (a *App) Run(arguments []string) error {
 		return nerr
 	}
 	context := NewContext(a, set, set)
+	context.flags = a.Flags
+	context.rawArgs = arguments
+	context.parentContext = a.parent
 
 	if err != nil {
-		fmt.Println("Incorrect Usage.")
+		fmt.Println(a.translate("Incorrect Usage."))
 		fmt.Println()
 		ShowAppHelp(context)
 		fmt.Println()
 		return err
 	}
 
+	return a.run(context)
+}
+
+// RunWithFlagSet runs the app like Run, but with the global flags already
+// parsed into set and with args as the arguments after them, for programs
+// that parse their own flags. The Flags of the app are not used.
+func (a *App) RunWithFlagSet(set *flag.FlagSet, args []string) error {
+	a.normalizeFlagNames()
+	a.appendCommands()
+
+	context := NewContext(a, set, set)
+	context.args = append(Args{}, args...)
+	return a.run(context)
+}
+
+// appendCommands adds the commands cli provides to the commands of the app.
+func (a *App) appendCommands() {
+	// append config to commands
+	if a.EnableConfigDumpCommand && a.Command(configCommand.Name) == nil {
+		a.Commands = append(a.Commands, configCommand)
+	}
+
+	// append the completion metadata to commands
+	if a.EnableBashCompletion && a.Command(metadataCommand.Name) == nil {
+		a.Commands = append(a.Commands, metadataCommand)
+	}
+
+	// append help to commands
+	if a.Command(helpCommand.Name) == nil {
+		a.Commands = append(a.Commands, helpCommand)
+	}
+}
+
+// run runs the action of the app or dispatches to the command given in the
+// arguments of the context, which holds the parsed global flags.
+func (a *App) run(context *Context) (err error) {
+	context.deferred = new([]func())
+	defer func() {
+		runDeferred(*context.deferred)
+	}()
+
 	if checkCompletions(context) {
 		return nil
 	}
@@ -126,6 +383,60 @@ func (a *App) Run(arguments []string) error {
 		return nil
 	}
 
+	// the built-in commands work without the flags the constraints require
+	if !isBuiltinCommand(context.Args().First()) {
+		if cerr := a.checkConstraints(context); cerr != nil {
+			fmt.Println(cerr)
+			fmt.Println()
+			ShowAppHelp(context)
+			fmt.Println()
+			return cerr
+		}
+	}
+
+	if a.Validate != nil {
+		if verr := a.Validate(context); verr != nil {
+			fmt.Println(verr)
+			fmt.Println()
+			ShowAppHelp(context)
+			fmt.Println()
+			return verr
+		}
+	}
+
+	if a.EnableProfilingFlags {
+		stop, perr := startProfiling(context.GlobalString("cpuprofile"), context.GlobalString("memprofile"))
+		if perr != nil {
+			return perr
+		}
+		defer func() {
+			if serr := stop(); serr != nil && err == nil {
+				err = serr
+			}
+		}()
+	}
+
+	if a.EnableOutputFileFlag {
+		restore, oerr := a.redirectOutput(context.GlobalString("output-file"))
+		if oerr != nil {
+			return oerr
+		}
+		defer func() {
+			if rerr := restore(); rerr != nil && err == nil {
+				err = rerr
+			}
+		}()
+	}
+
+	if a.BufferedOutput {
+		flush := a.bufferOutput()
+		defer func() {
+			if ferr := flush(); ferr != nil && err == nil {
+				err = ferr
+			}
+		}()
+	}
+
 	if a.Before != nil {
 		err := a.Before(context)
 		if err != nil {
@@ -133,23 +444,55 @@ func (a *App) Run(arguments []string) error {
 		}
 	}
 
+	if a.After != nil {
+		defer func() {
+			if aerr := a.After(context); aerr != nil && err == nil {
+				err = aerr
+			}
+		}()
+	}
+
 	args := context.Args()
+	if expansion, ok := a.aliases[args.First()]; ok && args.Present() {
+		args = append(append(Args{}, expansion...), args.Tail()...)
+		context.args = args
+	}
 	if args.Present() {
 		name := args.First()
 		c := a.Command(name)
 		if c != nil {
+			a.checkFlagScopes(context, c)
 			return c.Run(context)
 		}
 	}
+	if a.RootCommand != nil {
+		context.args = append(Args{a.RootCommand.Name}, args...)
+		return a.RootCommand.Run(context)
+	}
 
 	// Run default Action
-	a.Action(context)
+	if perr := context.preprocessArgs(a.PreprocessArgs); perr != nil {
+		fmt.Println(perr)
+		fmt.Println()
+		ShowAppHelp(context)
+		fmt.Println()
+		return perr
+	}
+	a.audit(context, a.Name)
+	return a.runAction(a.Action, context)
+}
 
-	return nil
+// RunAndExitOnError runs the app with os.Args and exits the process with a
+// non-zero status if an error is returned.
+func (a *App) RunAndExitOnError() {
+	if err := a.Run(os.Args); err != nil {
+		fmt.Fprintln(a.errWriter(), err)
+		OsExiter(1)
+	}
 }
 
 // Invokes the subcommand given the context, parses ctx.Args() to generate command-specific flags
-func (a *App) RunAsSubcommand(ctx *Context) error {
+func (a *App) RunAsSubcommand(ctx *Context) (err error) {
 	// append help to commands
 	if len(a.Commands) > 0 {
 		if a.Command(helpCommand.Name) == nil {
@@ -161,14 +504,22 @@ func (a *App) RunAsSubcommand(ctx *Context) error {
 	if a.EnableBashCompletion {
 		a.appendFlag(BashCompletionFlag)
 	}
-	a.appendFlag(BoolFlag{"help, h", "show help"})
+	if a.Version != "" {
+		a.appendFlag(a.translateUsage(commandVersionFlag))
+	}
+	a.appendFlag(a.translateUsage(helpFlag))
 
 	// parse flags
-	set := flagSet(a.Name, a.Flags)
-	set.SetOutput(ioutil.Discard)
-	err := set.Parse(ctx.Args().Tail())
+	set := a.newFlagSet(a.Name, a.Flags)
+	err = set.Parse(a.normalizeArgs(set, ctx.Args().Tail(), true))
 	nerr := normalizeFlags(a.Flags, set)
+	if nerr == nil && err == nil {
+		nerr = a.resolveFlags(a.Flags, set)
+	}
 	context := NewContext(a, set, set)
+	context.Command = ctx.Command
+	context.flags = a.Flags
+	context.parentContext = ctx
 
 	if nerr != nil {
 		fmt.Println(nerr)
@@ -178,13 +529,13 @@ func (a *App) RunAsSubcommand(ctx *Context) error {
 			ShowCommandHelp(ctx, context.Args().First())
 		}
 		fmt.Println("")
-		return nerr
+		return a.wrapError(a.Name, nerr)
 	}
 
 	if err != nil {
-		fmt.Printf("Incorrect Usage.\n\n")
+		fmt.Printf("%s\n\n", a.translate("Incorrect Usage."))
 		ShowSubcommandHelp(context)
-		return err
+		return a.wrapError(a.Name, err)
 	}
 
 	if checkCompletions(context) {
@@ -201,30 +552,60 @@ func (a *App) RunAsSubcommand(ctx *Context) error {
 		}
 	}
 
+	if a.Version != "" && a.isVersion(context) {
+		ShowVersion(context)
+		return nil
+	}
+
+	if a.Validate != nil {
+		if verr := a.Validate(context); verr != nil {
+			fmt.Println(verr)
+			fmt.Println()
+			ShowSubcommandHelp(context)
+			fmt.Println()
+			return a.wrapError(a.Name, verr)
+		}
+	}
+
 	if a.Before != nil {
 		err := a.Before(context)
 		if err != nil {
-			return err
+			return a.wrapError(a.Name, err)
 		}
 	}
 
+	if a.After != nil {
+		defer func() {
+			if aerr := a.After(context); aerr != nil && err == nil {
+				err = a.wrapError(a.Name, aerr)
+			}
+		}()
+	}
+
 	args := context.Args()
 	if args.Present() {
 		name := args.First()
 		c := a.Command(name)
 		if c != nil {
+			a.checkFlagScopes(context, c)
 			return c.Run(context)
 		}
 	}
 
 	// Run default Action
 	if len(a.Commands) > 0 {
-		a.Action(context)
-	} else {
-		a.Action(ctx)
+		if perr := context.preprocessArgs(a.PreprocessArgs, ctx.Command.PreprocessArgs); perr != nil {
+			fmt.Println(perr)
+			fmt.Println()
+			ShowSubcommandHelp(context)
+			fmt.Println()
+			return a.wrapError(a.Name, perr)
+		}
+		a.audit(context, a.Name)
+		return a.wrapError(a.Name, a.runAction(a.Action, context))
 	}
-
-	return nil
+	a.audit(context, a.Name)
+	return a.wrapError(a.Name, a.runAction(a.Action, ctx))
 }
 
 // Command returns the named command on App. If the command does not exist, nil is returned.
@@ -234,19 +615,691 @@ func (a *App) Command(name string) *Command {
 			return &c
 		}
 	}
+	if a.RootCommand != nil && a.RootCommand.HasName(name) {
+		return a.RootCommand
+	}
+	return nil
+}
+
+// multiCallArgs prepends the name of the command that the binary at path is
+// named after to args, if there is such a command.
+func (a *App) multiCallArgs(path string, args []string) []string {
+	name := strings.TrimSuffix(filepath.Base(path), ".exe")
+	if !strings.HasPrefix(name, a.MultiCallPrefix) {
+		return args
+	}
+	name = strings.TrimPrefix(name, a.MultiCallPrefix)
+	if a.Command(name) == nil {
+		return args
+	}
+	return append([]string{name}, args...)
+}
+
+// FindCommands returns the commands and subcommands, at any depth, that
+// satisfy pred, in the order they are defined. The pointers refer to the
+// commands in the Commands and Subcommands slices.
+func (a *App) FindCommands(pred func(*Command) bool) []*Command {
+	return findCommands(a.Commands, pred)
+}
+
+func findCommands(commands []Command, pred func(*Command) bool) []*Command {
+	var found []*Command
+	for i := range commands {
+		if pred(&commands[i]) {
+			found = append(found, &commands[i])
+		}
+		found = append(found, findCommands(commands[i].Subcommands, pred)...)
+	}
+	return found
+}
+
+// isBuiltinCommand reports whether name is the name of one of the commands
+// added by the app itself, like help.
+func isBuiltinCommand(name string) bool {
+	return name != "" && (helpCommand.HasName(name) || configCommand.HasName(name) || metadataCommand.HasName(name))
+}
+
+// checkConstraints checks that the global flags set in the context satisfy
+// the constraints of the app.
+func (a *App) checkConstraints(context *Context) error {
+	for _, group := range a.RequireExactlyOne {
+		count := 0
+		for _, name := range group {
+			if context.IsSet(name) {
+				count++
+			}
+		}
+		if count != 1 {
+			return errors.New("Exactly one of these flags must be set: " + prefixedNames(strings.Join(group, ", ")))
+		}
+	}
+
+	names := make([]string, 0, len(a.Implies))
+	for name := range a.Implies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !context.IsSet(name) {
+			continue
+		}
+		for _, required := range a.Implies[name] {
+			if !context.IsSet(required) {
+				return fmt.Errorf("%s%s requires %s%s", prefixFor(name), name, prefixFor(required), required)
+			}
+		}
+	}
 	return nil
 }
 
+// normalizeFlagNames renames the flags of the app and its commands to their
+// kebab-case names, if EnableFlagNameNormalization is set.
+func (a *App) normalizeFlagNames() {
+	if !a.EnableFlagNameNormalization {
+		return
+	}
+	a.Flags = kebabCaseFlags(a.Flags)
+	normalizeCommandFlagNames(a.Commands)
+}
+
+// normalizeCommandFlagNames renames the flags of the commands and their
+// subcommands to their kebab-case names.
+func normalizeCommandFlagNames(commands []Command) {
+	for i := range commands {
+		commands[i].Flags = kebabCaseFlags(commands[i].Flags)
+		normalizeCommandFlagNames(commands[i].Subcommands)
+	}
+}
+
+// normalizeArgs rewrites the flag names in args to the names of the flags
+// defined in set, according to the flag name settings of the app.
+func (a *App) normalizeArgs(set *flag.FlagSet, args []string, stopAtPositional bool) []string {
+	if !a.EnableFlagNameNormalization && !a.CaseInsensitiveFlags {
+		return args
+	}
+	return rewriteFlagArgs(set, args, stopAtPositional, func(name string) string {
+		return a.lookupName(set, name)
+	})
+}
+
+// lookupName returns the name of the flag in set that name refers to,
+// according to the flag name settings of the app.
+func (a *App) lookupName(set *flag.FlagSet, name string) string {
+	if a.EnableFlagNameNormalization {
+		name = matchFlagName(set, name)
+	}
+	if a.CaseInsensitiveFlags && set.Lookup(name) == nil {
+		set.VisitAll(func(f *flag.Flag) {
+			if strings.EqualFold(f.Name, name) {
+				name = f.Name
+			}
+		})
+	}
+	return name
+}
+
+// hoistGlobalFlags moves the global flags given after the command, together
+// with their values, in front of the command. Flags the command defines
+// itself, and the arguments after a "--" terminator, are left in place.
+func (a *App) hoistGlobalFlags(set *flag.FlagSet, args []string) []string {
+	var globals, rest []string
+	var command *Command
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+
+		name, hasValue := flagName(arg)
+		if name == "" {
+			if command == nil {
+				if command = a.Command(arg); command == nil || command.SkipFlagParsing {
+					// not a command, or one that takes the remaining arguments verbatim
+					rest = append(rest, args[i:]...)
+					break
+				}
+			}
+			rest = append(rest, arg)
+			continue
+		}
+
+		name = a.lookupName(set, name)
+		if command != nil {
+			if cf := command.lookupFlag(name); cf != nil {
+				// keep the value of the command flag with it
+				rest = append(rest, arg)
+				cset := flagSet(command.Name, []Flag{cf}, flag.ContinueOnError)
+				if !hasValue && !isBoolFlag(cset.Lookup(name)) && i+1 < len(args) {
+					i++
+					rest = append(rest, args[i])
+				}
+				continue
+			}
+		}
+		f := set.Lookup(name)
+		if f == nil {
+			rest = append(rest, arg)
+			continue
+		}
+
+		globals = append(globals, arg)
+		if !hasValue && !isBoolFlag(f) && i+1 < len(args) {
+			i++
+			globals = append(globals, args[i])
+		}
+	}
+	return append(globals, rest...)
+}
+
+// rootArgs inserts the name of the root command in front of the first flag
+// that is not a global flag, unless a command is given before it, so that the
+// flag is parsed by the root command.
+func (a *App) rootArgs(set *flag.FlagSet, args []string) []string {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, hasValue := flagName(arg)
+		if arg == "--" || name == "" {
+			// the remaining arguments go to a command, or to the root command
+			return args
+		}
+
+		f := set.Lookup(a.lookupName(set, name))
+		if f == nil {
+			return append(append(args[:i:i], a.RootCommand.Name), args[i:]...)
+		}
+		if !hasValue && !isBoolFlag(f) {
+			i++
+		}
+	}
+	return args
+}
+
+// translate returns the translation of the given English string.
+func (a *App) translate(key string) string {
+	if a == nil || a.Translator == nil {
+		return key
+	}
+	if s := a.Translator(key); s != "" {
+		return s
+	}
+	return key
+}
+
+// translateUsage returns the given flag, one of the flags cli adds itself,
+// with its usage translated.
+func (a *App) translateUsage(f Flag) Flag {
+	switch f := f.(type) {
+	case BoolFlag:
+		f.Usage = a.translate(f.Usage)
+		return f
+	case StringFlag:
+		f.Usage = a.translate(f.Usage)
+		return f
+	}
+	return f
+}
+
+// wrapError prefixes err with the given command path if WrapActionErrors is set.
+func (a *App) wrapError(path string, err error) error {
+	if err == nil || !a.WrapActionErrors {
+		return err
+	}
+	return fmt.Errorf("%s: %w", path, err)
+}
+
+// writer returns the Writer of the app, or os.Stdout if it is not set.
+func (a *App) writer() io.Writer {
+	if a == nil || a.Writer == nil {
+		return os.Stdout
+	}
+	return a.Writer
+}
+
+// reader returns the Reader of the app, or os.Stdin if it is not set.
+func (a *App) reader() io.Reader {
+	if a == nil || a.Reader == nil {
+		return os.Stdin
+	}
+	return a.Reader
+}
+
+// errWriter returns the ErrWriter of the app, or os.Stderr if it is not set.
+func (a *App) errWriter() io.Writer {
+	if a == nil || a.ErrWriter == nil {
+		return os.Stderr
+	}
+	return a.ErrWriter
+}
+
+// traceCompletion prints a line about how completions are computed, if
+// CompletionDebug is set.
+func (a *App) traceCompletion(format string, args ...interface{}) {
+	if a.CompletionDebug {
+		fmt.Fprintf(a.errWriter(), "completion: "+format+"\n", args...)
+	}
+}
+
+// newFlagSet creates a flag set for the given flags, which handles errors
+// according to FlagErrorHandling.
+func (a *App) newFlagSet(name string, flags []Flag) *flag.FlagSet {
+	set := flagSet(name, flags, a.FlagErrorHandling)
+	if a.FlagErrorHandling == flag.ContinueOnError {
+		set.SetOutput(ioutil.Discard)
+	} else {
+		set.SetOutput(a.errWriter())
+	}
+	return set
+}
+
+// inherit makes the app use the output and the settings for the whole run of
+// parent, the app it is a command of.
+func (a *App) inherit(parent *App) {
+	a.EnableHelpPager = parent.EnableHelpPager
+	a.CompactHelp = parent.CompactHelp
+
+	// output
+	a.Reader = parent.Reader
+	a.Writer = parent.Writer
+	a.buffer = parent.buffer
+	a.ErrWriter = parent.ErrWriter
+	a.WrapActionErrors = parent.WrapActionErrors
+	a.BatchMode = parent.BatchMode
+	a.Translator = parent.Translator
+	a.AuditWriter = parent.AuditWriter
+	a.EnableExecFlagValues = parent.EnableExecFlagValues
+	a.EnableFlagInterpolation = parent.EnableFlagInterpolation
+	a.valueResolvers = parent.valueResolvers
+	a.defaults = parent.defaults
+	a.middlewares = parent.middlewares
+
+	// bash completion
+	a.EnableBashCompletion = parent.EnableBashCompletion
+	a.CompletionDebug = parent.CompletionDebug
+	a.CompletionCacheDir = parent.CompletionCacheDir
+
+	// flag parsing
+	a.EnableFlagNameNormalization = parent.EnableFlagNameNormalization
+	a.CaseInsensitiveFlags = parent.CaseInsensitiveFlags
+	a.FlagErrorHandling = parent.FlagErrorHandling
+	a.GlobalFlagsAnywhere = parent.GlobalFlagsAnywhere
+	a.IsHelp = parent.IsHelp
+	a.IsVersion = parent.IsVersion
+
+	// actions
+	a.PreprocessArgs = parent.PreprocessArgs
+	a.CommandNotFound = parent.CommandNotFound
+}
+
+// Use adds a middleware that wraps the actions of the app and its commands,
+// e.g. to time or log them or to recover from panics. A middleware calls next
+// to run the action. Middlewares run in the order they were added, so the
+// first one is the outermost.
+func (a *App) Use(middleware func(next ActionFunc) ActionFunc) {
+	a.middlewares = append(a.middlewares, middleware)
+}
+
+// runAction runs the action, wrapped in the middlewares of the app, with the
+// given context, and returns the error the action reported, see FuncAction.
+func (a *App) runAction(action ActionFunc, c *Context) error {
+	c.actionErr = nil
+	a.wrapAction(action)(c)
+	return c.actionErr
+}
+
+// wrapAction wraps the action in the middlewares of the app.
+func (a *App) wrapAction(action ActionFunc) ActionFunc {
+	for i := len(a.middlewares) - 1; i >= 0; i-- {
+		action = a.middlewares[i](action)
+	}
+	return action
+}
+
+// WithDefaults returns a copy of the app that uses the given values, keyed by
+// flag name, as the defaults of its global and command flags. Unlike the Value
+// of a flag, they do not show in help, and the arguments can still override them.
+// Run returns an error if a value is invalid for its flag.
+func (a *App) WithDefaults(defaults map[string]string) *App {
+	app := *a
+	app.defaults = make(map[string]string)
+	for name, value := range a.defaults {
+		app.defaults[name] = value
+	}
+	for name, value := range defaults {
+		app.defaults[name] = value
+	}
+	return &app
+}
+
+// computeDefaults sets the flags in set that are not set by the arguments to
+// the values computed by their DefaultFunc.
+func computeDefaults(flags []Flag, set *flag.FlagSet) {
+	for _, f := range flags {
+		cf, ok := f.(computedFlag)
+		if !ok {
+			continue
+		}
+		given := false
+		eachName(f.getName(), func(name string) {
+			given = given || isSet(set, name)
+		})
+		if given {
+			continue
+		}
+		value, ok := cf.computeDefault()
+		if !ok {
+			continue
+		}
+		eachName(f.getName(), func(name string) {
+			if ff := set.Lookup(name); ff != nil {
+				ff.Value.Set(value)
+			}
+		})
+	}
+}
+
+// applyDefaults sets the values given to WithDefaults on the flags in set
+// that are not set by the arguments. The values of slice flags are replaced,
+// not appended to, and the Value of the flag itself is left unchanged.
+func (a *App) applyDefaults(flags []Flag, set *flag.FlagSet) error {
+	for _, f := range flags {
+		var value, first string
+		found, given := false, false
+		eachName(f.getName(), func(name string) {
+			if first == "" {
+				first = name
+			}
+			if v, ok := a.defaults[name]; ok && !found {
+				value, found = v, true
+			}
+			given = given || isSet(set, name)
+		})
+		if !found || given || set.Lookup(first) == nil {
+			continue
+		}
+
+		// the names of slice flags share one value, which is the Value of
+		// the flag, so they get a new one
+		var fresh flag.Value
+		switch set.Lookup(first).Value.(type) {
+		case *StringSlice:
+			fresh = &StringSlice{}
+		case *IntSlice:
+			fresh = &IntSlice{}
+		}
+		var err error
+		eachName(f.getName(), func(name string) {
+			v := set.Lookup(name)
+			if fresh != nil {
+				v.Value = fresh
+			} else if err == nil {
+				err = v.Value.Set(value)
+			}
+		})
+		if fresh != nil {
+			err = fresh.Set(value)
+		}
+		if err != nil {
+			return fmt.Errorf("Invalid default %q for flag %s%s: %v", value, prefixFor(first), first, err)
+		}
+	}
+	return nil
+}
+
+// AddCommand adds the command below the commands named by path, which are
+// created if they do not exist yet. An error is returned if a command with
+// the same name already exists at that place.
+func (a *App) AddCommand(path []string, command Command) error {
+	commands, err := addCommand(a.Commands, path, command)
+	if err != nil {
+		names := append(append([]string(nil), path...), command.Name)
+		return fmt.Errorf("Cannot add command '%s': %v", strings.Join(names, " "), err)
+	}
+	a.Commands = commands
+	return nil
+}
+
+// AddAlias adds an alias that, given as the command, runs the given command
+// with the given arguments in front of the arguments after the alias. For
+// example, after AddAlias("ll", "list", "--long", "--all"), "ll -r" runs
+// "list --long --all -r". An alias takes precedence over a command of the
+// same name.
+func (a *App) AddAlias(name, command string, args ...string) {
+	if a.aliases == nil {
+		a.aliases = make(map[string][]string)
+	}
+	a.aliases[name] = append([]string{command}, args...)
+}
+
+// Mount adds a command that runs sub with the arguments after the command
+// name, so that an independent App can be one of the commands of this one.
+// The name of sub is prefixed with the name of this app while it runs.
+func (a *App) Mount(name string, sub *App) error {
+	return a.AddCommand(nil, Command{Name: name, Usage: sub.Usage, app: sub})
+}
+
+// addCommand adds the command to commands below the given path.
+func addCommand(commands []Command, path []string, command Command) ([]Command, error) {
+	if len(path) == 0 {
+		for _, c := range commands {
+			if c.HasName(command.Name) || (command.ShortName != "" && c.HasName(command.ShortName)) {
+				return nil, errors.New("a command with the same name exists")
+			}
+		}
+		return append(commands, command), nil
+	}
+
+	for i := range commands {
+		if commands[i].HasName(path[0]) {
+			subcommands, err := addCommand(commands[i].Subcommands, path[1:], command)
+			if err != nil {
+				return nil, err
+			}
+			commands[i].Subcommands = subcommands
+			return commands, nil
+		}
+	}
+
+	subcommands, err := addCommand(nil, path[1:], command)
+	if err != nil {
+		return nil, err
+	}
+	return append(commands, Command{Name: path[0], Subcommands: subcommands}), nil
+}
+
+// resolveFlags runs the passes over the parsed flags that may replace their
+// values or reject them.
+func (a *App) resolveFlags(flags []Flag, set *flag.FlagSet) error {
+	computeDefaults(flags, set)
+	if err := a.applyDefaults(flags, set); err != nil {
+		return err
+	}
+	if err := a.resolveValues(flags, set); err != nil {
+		return err
+	}
+	if err := a.interpolateValues(flags, set); err != nil {
+		return err
+	}
+	a.replaceDeprecatedValues(flags, set)
+	return validateFlags(flags, set)
+}
+
+// resolveValues replaces the values of string flags that refer to a value
+// source, like "exec:get-token", with the value they refer to.
+func (a *App) resolveValues(flags []Flag, set *flag.FlagSet) error {
+	for _, f := range flags {
+		sf, ok := f.(StringFlag)
+		if !ok {
+			continue
+		}
+		name := strings.TrimSpace(strings.Split(sf.Name, ",")[0])
+		value := lookupString(name, set)
+
+		resolved, err := a.resolveValue(value)
+		if err != nil {
+			return fmt.Errorf("Cannot resolve the value of %s%s: %v", prefixFor(name), name, err)
+		}
+		if resolved == value {
+			continue
+		}
+		setValue(set, sf.Name, resolved)
+	}
+	return nil
+}
+
+// RegisterValueResolver makes fn resolve the values of string flags that
+// start with the given scheme followed by "://", e.g. "vault" for
+// --token vault://secret/ci#token. fn is given the part after "://" and
+// returns the value to use. An error fails the parsing of the flags.
+func (a *App) RegisterValueResolver(scheme string, fn func(ref string) (string, error)) {
+	if a.valueResolvers == nil {
+		a.valueResolvers = make(map[string]func(ref string) (string, error))
+	}
+	a.valueResolvers[scheme] = fn
+}
+
+// resolveValue returns the value the given flag value refers to, or the
+// value itself if it does not refer to a value source.
+func (a *App) resolveValue(value string) (string, error) {
+	if i := strings.Index(value, "://"); i > 0 {
+		if fn, ok := a.valueResolvers[value[:i]]; ok {
+			return fn(value[i+len("://"):])
+		}
+	}
+	if a.EnableExecFlagValues && strings.HasPrefix(value, "exec:") {
+		args := strings.Fields(strings.TrimPrefix(value, "exec:"))
+		if len(args) == 0 {
+			return "", errors.New("no command given")
+		}
+		out, err := exec.Command(args[0], args[1:]...).Output()
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	return value, nil
+}
+
+// flagReference matches a reference to a flag in a value, like ${host}.
+var flagReference = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// interpolateValues expands the references to other flags in the values of
+// string flags, if EnableFlagInterpolation is set.
+func (a *App) interpolateValues(flags []Flag, set *flag.FlagSet) error {
+	if !a.EnableFlagInterpolation {
+		return nil
+	}
+
+	expanded := make(map[string]string)
+	for _, f := range flags {
+		sf, ok := f.(StringFlag)
+		if !ok {
+			continue
+		}
+		name := strings.TrimSpace(strings.Split(sf.Name, ",")[0])
+		value, err := interpolate(name, set, expanded, nil)
+		if err != nil {
+			return fmt.Errorf("Cannot interpolate the value of %s%s: %v", prefixFor(name), name, err)
+		}
+		if value == lookupString(name, set) {
+			continue
+		}
+		setValue(set, sf.Name, value)
+	}
+	return nil
+}
+
+// interpolate returns the value of the named flag with its references
+// expanded. The expanded values are cached in expanded, and visiting holds
+// the flags whose values are being expanded, to detect circular references.
+func interpolate(name string, set *flag.FlagSet, expanded map[string]string, visiting []string) (string, error) {
+	if value, ok := expanded[name]; ok {
+		return value, nil
+	}
+	for _, v := range visiting {
+		if v == name {
+			return "", fmt.Errorf("circular reference %s", strings.Join(append(visiting, name), " -> "))
+		}
+	}
+	f := set.Lookup(name)
+	if f == nil {
+		return "", fmt.Errorf("unknown flag '%s'", name)
+	}
+
+	var err error
+	value := flagReference.ReplaceAllStringFunc(f.Value.String(), func(ref string) string {
+		if err != nil {
+			return ref
+		}
+		var v string
+		v, err = interpolate(flagReference.FindStringSubmatch(ref)[1], set, expanded, append(visiting, name))
+		return v
+	})
+	if err != nil {
+		return "", err
+	}
+	expanded[name] = value
+	return value, nil
+}
+
+// replaceDeprecatedValues replaces the values given to string flags that are
+// keys of DeprecatedValues with their replacements, and warns about it.
+// Default values are left alone.
+func (a *App) replaceDeprecatedValues(flags []Flag, set *flag.FlagSet) {
+	for _, f := range flags {
+		sf, ok := f.(StringFlag)
+		if !ok || !isSetAny(set, sf.Name) {
+			continue
+		}
+		name := strings.TrimSpace(strings.Split(sf.Name, ",")[0])
+		value := lookupString(name, set)
+		replacement, ok := sf.DeprecatedValues[value]
+		if !ok {
+			continue
+		}
+
+		fmt.Fprintf(a.errWriter(), a.translate("Warning: value '%s' of %s%s is deprecated, using '%s' instead")+"\n", value, prefixFor(name), name, replacement)
+		setValue(set, sf.Name, replacement)
+	}
+}
+
 // hasFlag checks for the presence of a flag.
 func (a *App) hasFlag(flag Flag) bool {
 	for _, f := range a.Flags {
-		if flag == f {
+		if flag.getName() == f.getName() {
 			return true
 		}
 	}
 	return false
 }
 
+// checkFlagScopes prints a warning for every flag that was set although it
+// does not apply to the given command.
+func (a *App) checkFlagScopes(context *Context, command *Command) {
+	for _, f := range a.Flags {
+		names := f.appliesTo()
+		if len(names) == 0 {
+			continue
+		}
+
+		applies, isSet := false, false
+		for _, name := range names {
+			if command.HasName(name) {
+				applies = true
+			}
+		}
+		eachName(f.getName(), func(name string) {
+			if context.IsSet(name) {
+				isSet = true
+			}
+		})
+
+		if isSet && !applies {
+			fmt.Fprintf(a.errWriter(), a.translate("Warning: %s does not apply to command '%v'")+"\n", prefixedNames(f.getName()), command.Name)
+		}
+	}
+}
+
 // appendFlag appends a flag if it does not already exist.
 func (a *App) appendFlag(flag Flag) {
 	if !a.hasFlag(flag) {
@@ -1,10 +1,19 @@
 package cli_test
 
 import (
+	"bytes"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/codegangsta/cli"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 func ExampleApp() {
@@ -366,3 +375,1263 @@ func TestAppCommandNotFound(t *testing.T) {
 	expect(t, beforeRun, true)
 	expect(t, subcommandRun, false)
 }
+
+func TestAppNestedCommandInheritsApp(t *testing.T) {
+	interactive := true
+	var notFound string
+	app := cli.NewApp()
+	app.BatchMode = true
+	app.CommandNotFound = func(c *cli.Context, command string) {
+		notFound = command
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "remote",
+			Subcommands: []cli.Command{
+				{
+					Name: "add",
+					Action: func(c *cli.Context) {
+						interactive = c.Interactive()
+					},
+				},
+			},
+		},
+	}
+
+	app.Run([]string{"command", "remote", "add"})
+	expect(t, interactive, false)
+
+	app.Run([]string{"command", "remote", "help", "rename"})
+	expect(t, notFound, "rename")
+}
+
+func TestApp_RunAndExitOnError(t *testing.T) {
+	oldExiter, oldArgs := cli.OsExiter, os.Args
+	defer func() {
+		cli.OsExiter, os.Args = oldExiter, oldArgs
+	}()
+
+	exitCode := -1
+	cli.OsExiter = func(code int) {
+		exitCode = code
+	}
+
+	app := cli.NewApp()
+	app.Before = func(c *cli.Context) error {
+		return fmt.Errorf("fail")
+	}
+
+	os.Args = []string{"command"}
+	app.RunAndExitOnError()
+	expect(t, exitCode, 1)
+
+	exitCode = -1
+	app.Before = nil
+	app.Action = func(c *cli.Context) {}
+	app.RunAndExitOnError()
+	expect(t, exitCode, -1)
+}
+
+func TestApp_FlagAppliesTo(t *testing.T) {
+	buildRun, cleanRun := false, false
+	var errOut bytes.Buffer
+
+	app := cli.NewApp()
+	app.ErrWriter = &errOut
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "target, t", AppliesTo: []string{"build"}},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "build",
+			Action: func(c *cli.Context) {
+				buildRun = true
+				expect(t, c.GlobalString("target"), "linux")
+			},
+		},
+		{
+			Name: "clean",
+			Action: func(c *cli.Context) {
+				cleanRun = true
+			},
+		},
+	}
+
+	err := app.Run([]string{"command", "-t", "linux", "build"})
+	expect(t, err, nil)
+	expect(t, buildRun, true)
+	expect(t, errOut.String(), "")
+
+	// inapplicable flags only produce a warning
+	err = app.Run([]string{"command", "--target", "linux", "clean"})
+	expect(t, err, nil)
+	expect(t, cleanRun, true)
+	expect(t, errOut.String(), "Warning: --target, -t does not apply to command 'clean'\n")
+}
+
+func TestApp_Translator(t *testing.T) {
+	app := cli.NewApp()
+	app.Translator = func(key string) string {
+		if key == "show help" {
+			return "Hilfe anzeigen"
+		}
+		return ""
+	}
+	app.Action = func(c *cli.Context) {}
+	app.Run([]string{"command"})
+
+	usages := map[string]bool{}
+	for _, f := range app.Flags {
+		usages[f.String()] = true
+	}
+	expect(t, usages["--help, -h\tHilfe anzeigen"], true)
+	expect(t, usages["--version, -v\tprint the version"], true)
+}
+
+func TestApp_TranslatorNested(t *testing.T) {
+	var errOut bytes.Buffer
+	app := cli.NewApp()
+	app.ErrWriter = &errOut
+	app.Translator = func(key string) string {
+		if key == "Warning: command '%v' is deprecated: %s" {
+			return "Warnung: Befehl '%v' ist veraltet: %s"
+		}
+		return ""
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "remote",
+			Subcommands: []cli.Command{
+				{
+					Name:       "add",
+					Deprecated: "use create",
+					Action:     func(c *cli.Context) {},
+				},
+			},
+		},
+	}
+
+	err := app.Run([]string{"command", "remote", "add"})
+	expect(t, err, nil)
+	expect(t, errOut.String(), "Warnung: Befehl 'add' ist veraltet: use create\n")
+}
+
+func ExampleApp_Run_bashCompleteNested() {
+	app := cli.NewApp()
+	app.Name = "mytool"
+	app.EnableBashCompletion = true
+	app.Commands = []cli.Command{
+		{
+			Name: "remote",
+			Subcommands: []cli.Command{
+				{
+					Name: "add",
+					Flags: []cli.Flag{
+						cli.BoolFlag{Name: "fetch, f"},
+					},
+					Action: func(c *cli.Context) {},
+				},
+				{Name: "remove", ShortName: "rm", Action: func(c *cli.Context) {}},
+			},
+		},
+	}
+
+	app.Run([]string{"mytool", "remote", "--generate-bash-completion"})
+	app.Run([]string{"mytool", "remote", "add", "--generate-bash-completion"})
+	// Output:
+	// add
+	// remove
+	// rm
+	// help
+	// h
+	// --fetch
+	// -f
+}
+
+func ExampleApp_Run_bashCompleteFlagValue() {
+	regions := func(c *cli.Context, prefix string) []string {
+		return []string{"eu-west-1", "us-east-1"}
+	}
+
+	app := cli.NewApp()
+	app.Name = "mytool"
+	app.EnableBashCompletion = true
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "profile", CompleteFunc: func(c *cli.Context, prefix string) []string {
+			return []string{"default", "prod"}
+		}},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "deploy",
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{Name: "region, r", Value: &cli.StringSlice{}, CompleteFunc: regions},
+			},
+			Action: func(c *cli.Context) {},
+		},
+	}
+
+	app.Run([]string{"mytool", "--profile", "--generate-bash-completion"})
+	app.Run([]string{"mytool", "deploy", "-r", "--generate-bash-completion"})
+	// Output:
+	// default
+	// prod
+	// eu-west-1
+	// us-east-1
+}
+
+func ExampleApp_Run_bashCompleteDebug() {
+	app := cli.NewApp()
+	app.Name = "mytool"
+	app.EnableBashCompletion = true
+	app.CompletionDebug = true
+	app.ErrWriter = os.Stdout
+	app.Commands = []cli.Command{
+		{
+			Name: "deploy",
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "force, f"},
+				cli.StringFlag{Name: "env", CompleteFunc: func(c *cli.Context, prefix string) []string {
+					return []string{"staging", "prod"}
+				}},
+			},
+			Action: func(c *cli.Context) {},
+		},
+	}
+
+	app.Run([]string{"mytool", "deploy", "--generate-bash-completion"})
+	app.Run([]string{"mytool", "deploy", "--env", "--generate-bash-completion"})
+	// Output:
+	// completion: matched command 'deploy'
+	// completion: completing the flag names of command 'deploy'
+	// completion: candidates: --force -f --env
+	// --force
+	// -f
+	// --env
+	// completion: completing the value of flag 'env'
+	// completion: candidates: staging prod
+	// staging
+	// prod
+}
+
+func ExampleApp_Run_bashCompleteCache() {
+	dir, _ := ioutil.TempDir("", "completion")
+	defer os.RemoveAll(dir)
+
+	calls := 0
+	app := cli.NewApp()
+	app.Name = "mytool"
+	app.EnableBashCompletion = true
+	app.CompletionCacheDir = dir
+	app.Commands = []cli.Command{
+		{
+			Name:               "logs",
+			CompletionCacheTTL: time.Minute,
+			BashComplete: func(c *cli.Context) {
+				calls++
+				fmt.Println("web-1")
+				fmt.Println("web-2")
+			},
+			Action: func(c *cli.Context) {},
+		},
+	}
+
+	app.Run([]string{"mytool", "logs", "--generate-bash-completion"})
+	app.Run([]string{"mytool", "logs", "--generate-bash-completion"})
+	fmt.Println(calls)
+
+	app.ClearCompletionCache()
+	app.Run([]string{"mytool", "logs", "--generate-bash-completion"})
+	fmt.Println(calls)
+	// Output:
+	// web-1
+	// web-2
+	// web-1
+	// web-2
+	// 1
+	// web-1
+	// web-2
+	// 2
+}
+
+func TestAppCompletionCacheDefaultDir(t *testing.T) {
+	home, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	oldHome := os.Getenv("XDG_CACHE_HOME")
+	os.Setenv("XDG_CACHE_HOME", home)
+	defer os.Setenv("XDG_CACHE_HOME", oldHome)
+
+	app := cli.NewApp()
+	app.Name = "mytool"
+	app.EnableBashCompletion = true
+	app.Commands = []cli.Command{
+		{
+			Name:               "logs",
+			CompletionCacheTTL: time.Minute,
+			BashComplete:       func(c *cli.Context) {},
+			Action:             func(c *cli.Context) {},
+		},
+	}
+	app.Run([]string{"mytool", "logs", "--generate-bash-completion"})
+
+	files, err := ioutil.ReadDir(filepath.Join(home, "mytool", "completion"))
+	expect(t, err, nil)
+	expect(t, len(files), 1)
+	expect(t, files[0].Mode().Perm(), os.FileMode(0600))
+}
+
+func ExampleApp_Run_bashCompleteDeprecated() {
+	// set args for examples sake
+	os.Args = []string{"greet", "--generate-bash-completion"}
+
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.EnableBashCompletion = true
+	app.Commands = []cli.Command{
+		{
+			Name:   "describeit",
+			Action: func(c *cli.Context) {},
+		}, {
+			Name:       "old",
+			Deprecated: "use 'describeit' instead",
+			Action:     func(c *cli.Context) {},
+		},
+	}
+
+	app.Run(os.Args)
+	// Output:
+	// describeit
+	// help
+	// h
+}
+
+func TestAppHelpFooter(t *testing.T) {
+	buf := captureHelp(t)
+
+	app := cli.NewApp()
+	app.HelpFooter = "See http://example.com/docs for more."
+	app.Run([]string{"greet", "-h"})
+
+	if !strings.HasSuffix(buf.String(), "\nSee http://example.com/docs for more.\n") {
+		t.Errorf("help footer not printed: %q", buf.String())
+	}
+}
+
+func TestAppHelpArgsUsage(t *testing.T) {
+	buf := captureHelp(t)
+
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{Name: "build", ShortName: "b", ArgsUsage: "<source> <dest>", Usage: "build the source"},
+	}
+	app.Run([]string{"greet", "-h"})
+
+	if !strings.Contains(buf.String(), "\n   build, b <source> <dest>\tbuild the source\n") {
+		t.Errorf("args usage not listed: %q", buf.String())
+	}
+}
+
+func ExampleCommand_argsUsage() {
+	app := cli.NewApp()
+	app.Name = "mytool"
+	app.Commands = []cli.Command{
+		{
+			Name:        "build",
+			Usage:       "build the source",
+			ArgsUsage:   "<source> <dest>",
+			Description: "Builds source into dest",
+			Action:      func(c *cli.Context) {},
+		},
+	}
+	app.Run([]string{"mytool", "help", "build"})
+	// Output:
+	// NAME:
+	//    build - build the source
+	//
+	// USAGE:
+	//    command build [command options] <source> <dest>
+	//
+	// DESCRIPTION:
+	//    Builds source into dest
+	//
+	// OPTIONS:
+}
+
+func TestAppHelpFlagGroups(t *testing.T) {
+	buf := captureHelp(t)
+
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{Name: "force", Usage: "deploy even if the checks fail"},
+		cli.StringFlag{Name: "host", Value: "localhost", Usage: "the server", Group: "Connection"},
+		cli.StringFlag{Name: "format", Value: "text", Usage: "the output format", Group: "Output"},
+		cli.IntFlag{Name: "port", Value: 22, Usage: "the port", Group: "Connection"},
+	}
+	app.Run([]string{"deploy", "-h"})
+
+	want := "GLOBAL OPTIONS:\n" +
+		"   --force\tdeploy even if the checks fail\n" +
+		"   --version, -v\tprint the version\n" +
+		"   --help, -h\tshow help\n" +
+		"   \n" +
+		"   Connection:\n" +
+		"   --host 'localhost'\tthe server\n" +
+		"   --port '22'\tthe port\n" +
+		"   \n" +
+		"   Output:\n" +
+		"   --format 'text'\tthe output format\n"
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("expected the grouped flags in the help, got:\n%s", buf.String())
+	}
+}
+
+func TestAppHelpDefaultAction(t *testing.T) {
+	buf := captureHelp(t)
+
+	app := cli.NewApp()
+	app.Name = "wc"
+	app.ArgsUsage = "<file>..."
+	app.Description = "Counts the lines of the given files"
+	app.Run([]string{"wc", "-h"})
+
+	expected := "USAGE:\n   wc [global options] command [command options] [arguments...]\n   wc [global options] <file>...\n\n"
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("default action usage not printed: %q", buf.String())
+	}
+	if !strings.Contains(buf.String(), "\nDESCRIPTION:\n   Counts the lines of the given files\n\nCOMMANDS:\n") {
+		t.Errorf("description not printed: %q", buf.String())
+	}
+}
+
+func TestApp_GlobalFlagsAnywhere(t *testing.T) {
+	var verbose bool
+	var config, name string
+	var args []string
+
+	app := cli.NewApp()
+	app.GlobalFlagsAnywhere = true
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{Name: "verbose"},
+		cli.StringFlag{Name: "config, c"},
+		cli.StringFlag{Name: "name"},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "build",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "name"},
+			},
+			Action: func(c *cli.Context) {
+				verbose = c.GlobalBool("verbose")
+				config = c.GlobalString("config")
+				name = c.String("name")
+				args = c.Args()
+			},
+		},
+	}
+
+	err := app.Run([]string{"command", "build", "--verbose", "-c", "ci.conf", "--name", "x", "--", "src", "--verbose"})
+	expect(t, err, nil)
+	expect(t, verbose, true)
+	expect(t, config, "ci.conf")
+	expect(t, name, "x")
+	expect(t, strings.Join(args, " "), "src --verbose")
+
+	// the values of command flags are not taken for global flags
+	verbose = false
+	err = app.Run([]string{"command", "build", "--name", "x", "--verbose"})
+	expect(t, err, nil)
+	expect(t, name, "x")
+	expect(t, verbose, true)
+
+	verbose = false
+	err = app.Run([]string{"command", "build", "--name", "--verbose"})
+	expect(t, err, nil)
+	expect(t, name, "--verbose")
+	expect(t, verbose, false)
+}
+
+func TestAppHelpPagerWithoutTerminal(t *testing.T) {
+	help := captureHelp(t)
+
+	// output is not a terminal while testing, so help is printed as usual
+	app := cli.NewApp()
+	app.EnableHelpPager = true
+	app.Run([]string{"greet", "-h"})
+
+	expect(t, len(help.templates), 1)
+}
+
+func ExampleApp_compactHelpPrinter() {
+	oldPrinter := cli.HelpPrinter
+	defer func() { cli.HelpPrinter = oldPrinter }()
+	cli.HelpPrinter = func(templ string, data interface{}) {
+		fmt.Println("OPTIONS:")
+		fmt.Println("   --loud\tshout the greeting")
+	}
+
+	// a custom HelpPrinter is also used for compact help
+	app := cli.NewApp()
+	app.CompactHelp = true
+	app.Run([]string{"greet", "-h"})
+	// Output:
+	// OPTIONS:
+	//    --loud
+	//        shout the greeting
+}
+
+func TestApp_RequireExactlyOne(t *testing.T) {
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "from-file, f"},
+		cli.StringFlag{Name: "from-url"},
+		cli.BoolFlag{Name: "from-stdin"},
+	}
+	app.RequireExactlyOne = [][]string{{"from-file", "from-url", "from-stdin"}}
+	app.Action = func(c *cli.Context) {}
+
+	err := app.Run([]string{"command", "-f", "input.txt"})
+	expect(t, err, nil)
+
+	err = app.Run([]string{"command", "--from-stdin"})
+	expect(t, err, nil)
+
+	err = app.Run([]string{"command"})
+	expect(t, err.Error(), "Exactly one of these flags must be set: --from-file, --from-url, --from-stdin")
+
+	err = app.Run([]string{"command", "--from-url", "http://example.com", "--from-stdin"})
+	refute(t, err, nil)
+
+	// help works without the required flags
+	help := captureHelp(t)
+	err = app.Run([]string{"command", "help"})
+	expect(t, err, nil)
+	expect(t, len(help.templates), 1)
+}
+
+func TestApp_Implies(t *testing.T) {
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{Name: "push"},
+		cli.StringFlag{Name: "registry"},
+		cli.StringFlag{Name: "tag, t"},
+	}
+	app.Implies = map[string][]string{"push": {"registry", "tag"}}
+	app.Action = func(c *cli.Context) {}
+
+	err := app.Run([]string{"command", "--push", "--registry", "example.com", "-t", "v1"})
+	expect(t, err, nil)
+
+	err = app.Run([]string{"command", "--registry", "example.com"})
+	expect(t, err, nil)
+
+	err = app.Run([]string{"command", "--push", "--tag", "v1"})
+	expect(t, err.Error(), "--push requires --registry")
+
+	err = app.Run([]string{"command", "--push", "--registry", "example.com"})
+	expect(t, err.Error(), "--push requires --tag")
+}
+
+func TestApp_FlagErrorHandling(t *testing.T) {
+	app := cli.NewApp()
+	app.ErrWriter = ioutil.Discard
+	app.FlagErrorHandling = flag.PanicOnError
+	app.Commands = []cli.Command{
+		{
+			Name:   "cmd",
+			Action: func(c *cli.Context) {},
+		},
+	}
+
+	for _, args := range [][]string{{"command", "-break"}, {"command", "cmd", "-break"}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected a panic for %v", args)
+				}
+			}()
+			app.Run(args)
+		}()
+	}
+}
+
+func TestApp_ArgsRewriter(t *testing.T) {
+	var style string
+	var rawArgs []string
+
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "new-style"},
+	}
+	app.ArgsRewriter = func(args []string) []string {
+		var rewritten []string
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "--old-style=") {
+				rewritten = append(rewritten, "--new-style", strings.TrimPrefix(arg, "--old-style="))
+			} else {
+				rewritten = append(rewritten, arg)
+			}
+		}
+		return rewritten
+	}
+	app.Action = func(c *cli.Context) {
+		style = c.String("new-style")
+		rawArgs = c.RawArgs()
+	}
+
+	err := app.Run([]string{"command", "--old-style=x"})
+	expect(t, err, nil)
+	expect(t, style, "x")
+	expect(t, strings.Join(rawArgs, " "), "command --old-style=x")
+}
+
+func TestApp_AddCommand(t *testing.T) {
+	added := ""
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{Name: "remote", ShortName: "r"},
+	}
+
+	err := app.AddCommand([]string{"remote", "branch"}, cli.Command{
+		Name: "add",
+		Action: func(c *cli.Context) {
+			added = c.Args().First()
+		},
+	})
+	expect(t, err, nil)
+	err = app.AddCommand([]string{"r"}, cli.Command{Name: "remove"})
+	expect(t, err, nil)
+	err = app.AddCommand(nil, cli.Command{Name: "status"})
+	expect(t, err, nil)
+
+	expect(t, len(app.Commands), 2)
+	expect(t, len(app.Command("remote").Subcommands), 2)
+
+	err = app.AddCommand([]string{"remote", "branch"}, cli.Command{Name: "add"})
+	expect(t, err.Error(), "Cannot add command 'remote branch add': a command with the same name exists")
+
+	err = app.Run([]string{"command", "remote", "branch", "add", "origin"})
+	expect(t, err, nil)
+	expect(t, added, "origin")
+}
+
+func TestApp_BeforeAndAfterChain(t *testing.T) {
+	var calls []string
+	hook := func(name string) func(c *cli.Context) error {
+		return func(c *cli.Context) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+
+	app := cli.NewApp()
+	app.Before = hook("app.Before")
+	app.After = hook("app.After")
+	app.Commands = []cli.Command{
+		{
+			Name:   "remote",
+			Before: hook("remote.Before"),
+			After:  hook("remote.After"),
+			Subcommands: []cli.Command{
+				{
+					Name:   "add",
+					Before: hook("add.Before"),
+					After:  hook("add.After"),
+					Action: func(c *cli.Context) {
+						calls = append(calls, "add")
+					},
+				},
+			},
+		},
+	}
+
+	err := app.Run([]string{"command", "remote", "add"})
+	expect(t, err, nil)
+	expect(t, strings.Join(calls, " "), "app.Before remote.Before add.Before add add.After remote.After app.After")
+}
+
+func TestApp_AfterFunc(t *testing.T) {
+	afterError := fmt.Errorf("fail")
+	afterRun := false
+
+	app := cli.NewApp()
+	app.Before = func(c *cli.Context) error {
+		if c.Bool("fail-before") {
+			return fmt.Errorf("before failed")
+		}
+		return nil
+	}
+	app.After = func(c *cli.Context) error {
+		afterRun = true
+		return afterError
+	}
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{Name: "fail-before"},
+	}
+	app.Action = func(c *cli.Context) {}
+
+	err := app.Run([]string{"command"})
+	expect(t, err, afterError)
+	expect(t, afterRun, true)
+
+	afterRun = false
+	err = app.Run([]string{"command", "--fail-before"})
+	expect(t, err.Error(), "before failed")
+	expect(t, afterRun, false)
+}
+
+func TestApp_VersionJSON(t *testing.T) {
+	var output bytes.Buffer
+	app := cli.NewApp()
+	app.Name = "mytool"
+	app.Version = "1.2.3"
+	app.Compiled = time.Date(2014, 7, 1, 12, 0, 0, 0, time.UTC)
+	app.EnableVersionJSON = true
+	app.Writer = &output
+	app.Action = func(c *cli.Context) {
+		t.Errorf("Action executed when NOT expected")
+	}
+
+	err := app.Run([]string{"command", "--version-json"})
+	expect(t, err, nil)
+	expect(t, output.String(), `{"name":"mytool","version":"1.2.3","compiled":"2014-07-01T12:00:00Z","go":"`+runtime.Version()+`"}`+"\n")
+
+	output.Reset()
+	err = app.Run([]string{"command", "--version"})
+	expect(t, err, nil)
+	expect(t, output.String(), "mytool version 1.2.3\n")
+}
+
+func ExampleApp_compactHelp() {
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.CompactHelp = true
+	app.Commands = []cli.Command{
+		{
+			Name:        "hello",
+			Usage:       "say hello",
+			Description: "greets the given name",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "name, n", Value: "world", Usage: "who to greet"},
+				cli.BoolFlag{Name: "loud"},
+			},
+			Action: func(c *cli.Context) {},
+		},
+	}
+
+	app.Run([]string{"greet", "hello", "--help"})
+	// Output:
+	// NAME:
+	//    hello - say hello
+	//
+	// USAGE:
+	//    command hello [command options] [arguments...]
+	//
+	// DESCRIPTION:
+	//    greets the given name
+	//
+	// OPTIONS:
+	//    --name, -n 'world'
+	//        who to greet
+	//    --loud
+}
+
+func TestApp_FindCommands(t *testing.T) {
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{Name: "user", Usage: "admin: manage users", Subcommands: []cli.Command{
+			{Name: "add", Usage: "admin: add a user"},
+			{Name: "list", Usage: "list users"},
+		}},
+		{Name: "status", Usage: "show the status"},
+	}
+
+	found := app.FindCommands(func(c *cli.Command) bool {
+		return strings.HasPrefix(c.Usage, "admin:")
+	})
+	expect(t, len(found), 2)
+	expect(t, found[0].Name, "user")
+	expect(t, found[1].Name, "add")
+
+	found[1].Usage = "admin: add users"
+	expect(t, app.Commands[0].Subcommands[0].Usage, "admin: add users")
+}
+
+func TestApp_MultiCall(t *testing.T) {
+	var ran string
+	var args []string
+	app := cli.NewApp()
+	app.MultiCall = true
+	app.MultiCallPrefix = "mytool-"
+	app.Commands = []cli.Command{
+		{
+			Name: "ls",
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "all, a"},
+			},
+			Action: func(c *cli.Context) {
+				ran = "ls"
+				if c.Bool("all") {
+					ran = "ls -a"
+				}
+				args = c.Args()
+			},
+		},
+	}
+	app.Action = func(c *cli.Context) {
+		ran = "app"
+		args = c.Args()
+	}
+
+	err := app.Run([]string{"/usr/bin/mytool-ls", "-a", "dir"})
+	expect(t, err, nil)
+	expect(t, ran, "ls -a")
+	expect(t, strings.Join(args, " "), "dir")
+
+	err = app.Run([]string{"/usr/bin/mytool", "ls"})
+	expect(t, err, nil)
+	expect(t, ran, "ls")
+
+	err = app.Run([]string{"/usr/bin/mytool-cat", "file"})
+	expect(t, err, nil)
+	expect(t, ran, "app")
+	expect(t, strings.Join(args, " "), "file")
+}
+
+func TestApp_Mount(t *testing.T) {
+	var pushed []string
+	var force bool
+	git := cli.NewApp()
+	git.Name = "git"
+	git.Usage = "version control"
+	git.Flags = []cli.Flag{
+		cli.BoolFlag{Name: "force, f"},
+	}
+	git.Commands = []cli.Command{
+		{
+			Name: "push",
+			Action: func(c *cli.Context) {
+				force = c.GlobalBool("force")
+				pushed = c.Args()
+			},
+		},
+	}
+
+	app := cli.NewApp()
+	app.Name = "umbrella"
+	expect(t, app.Mount("git", git), nil)
+	expect(t, app.Command("git").Usage, "version control")
+
+	err := app.Run([]string{"umbrella", "git", "-f", "push", "origin"})
+	expect(t, err, nil)
+	expect(t, force, true)
+	expect(t, strings.Join(pushed, " "), "origin")
+	expect(t, git.Name, "git")
+
+	err = app.Mount("git", cli.NewApp())
+	expect(t, err.Error(), "Cannot add command 'git': a command with the same name exists")
+}
+
+func TestApp_MountMiddleware(t *testing.T) {
+	var calls []string
+	trace := func(name string) func(next cli.ActionFunc) cli.ActionFunc {
+		return func(next cli.ActionFunc) cli.ActionFunc {
+			return func(c *cli.Context) {
+				calls = append(calls, name)
+				next(c)
+			}
+		}
+	}
+
+	git := cli.NewApp()
+	git.Use(trace("git"))
+	git.Commands = []cli.Command{
+		{
+			Name:   "push",
+			Action: func(c *cli.Context) {},
+		},
+	}
+
+	app := cli.NewApp()
+	app.Name = "umbrella"
+	app.Use(trace("umbrella"))
+	app.Mount("git", git)
+
+	err := app.Run([]string{"umbrella", "git", "push"})
+	expect(t, err, nil)
+	expect(t, strings.Join(calls, " "), "umbrella git")
+}
+
+func TestApp_MountInheritsApp(t *testing.T) {
+	var out bytes.Buffer
+	var verbose, interactive bool
+	git := cli.NewApp()
+	git.Commands = []cli.Command{
+		{
+			Name: "push",
+			Action: func(c *cli.Context) {
+				verbose = c.GlobalBool("verbose")
+				interactive = c.Interactive()
+				fmt.Fprintln(c.App.Writer, "pushed")
+			},
+		},
+	}
+
+	app := cli.NewApp()
+	app.Name = "umbrella"
+	app.Writer = &out
+	app.BatchMode = true
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{Name: "verbose"},
+	}
+	app.Mount("git", git)
+
+	err := app.Run([]string{"umbrella", "--verbose", "git", "push"})
+	expect(t, err, nil)
+	expect(t, verbose, true)
+	expect(t, interactive, false)
+	expect(t, out.String(), "pushed\n")
+}
+
+func TestApp_WithDefaults(t *testing.T) {
+	var env string
+	var port int
+	var portSet bool
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "env, e", Value: "dev"},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "serve",
+			Flags: []cli.Flag{
+				cli.IntFlag{Name: "port, p", Value: 80},
+			},
+			Action: func(c *cli.Context) {
+				env = c.GlobalString("e")
+				port = c.Int("port")
+				portSet = c.IsSet("port")
+			},
+		},
+	}
+
+	staging := app.WithDefaults(map[string]string{"env": "staging", "p": "8080"})
+
+	err := staging.Run([]string{"command", "serve"})
+	expect(t, err, nil)
+	expect(t, env, "staging")
+	expect(t, port, 8080)
+	expect(t, portSet, false)
+
+	err = staging.Run([]string{"command", "--env", "prod", "serve", "-p", "443"})
+	expect(t, err, nil)
+	expect(t, env, "prod")
+	expect(t, port, 443)
+
+	err = app.Run([]string{"command", "serve"})
+	expect(t, err, nil)
+	expect(t, env, "dev")
+	expect(t, port, 80)
+
+	err = app.WithDefaults(map[string]string{"port": "http"}).Run([]string{"command", "serve"})
+	expect(t, err.Error(), `Invalid default "http" for flag --port: parse error`)
+}
+
+func TestApp_WithDefaultsSlice(t *testing.T) {
+	var headers []string
+	defaultHeaders := &cli.StringSlice{"x-base"}
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.StringSliceFlag{Name: "hdr", Value: defaultHeaders},
+	}
+	app.Action = func(c *cli.Context) {
+		headers = c.StringSlice("hdr")
+	}
+	withDefaults := app.WithDefaults(map[string]string{"hdr": "a"})
+
+	err := withDefaults.Run([]string{"command"})
+	expect(t, err, nil)
+	expect(t, strings.Join(headers, ","), "a")
+	expect(t, strings.Join(defaultHeaders.Value(), ","), "x-base")
+
+	err = withDefaults.Run([]string{"command", "--hdr", "b"})
+	expect(t, err, nil)
+	expect(t, strings.Join(headers, ","), "x-base,b")
+}
+
+func TestApp_RunWithFlagSet(t *testing.T) {
+	set := flag.NewFlagSet("legacy", flag.ContinueOnError)
+	set.String("config", "default.yml", "config file")
+	set.Parse([]string{"--config", "prod.yml", "deploy", "now"})
+
+	var config string
+	var args []string
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{
+			Name: "deploy",
+			Action: func(c *cli.Context) {
+				config = c.GlobalString("config")
+				args = c.Args()
+			},
+		},
+	}
+
+	err := app.RunWithFlagSet(set, set.Args())
+	expect(t, err, nil)
+	expect(t, config, "prod.yml")
+	expect(t, strings.Join(args, " "), "now")
+}
+
+func TestAppUse(t *testing.T) {
+	var calls []string
+	trace := func(name string) func(next cli.ActionFunc) cli.ActionFunc {
+		return func(next cli.ActionFunc) cli.ActionFunc {
+			return func(c *cli.Context) {
+				calls = append(calls, name+" before")
+				next(c)
+				calls = append(calls, name+" after")
+			}
+		}
+	}
+
+	app := cli.NewApp()
+	app.Use(trace("outer"))
+	app.Use(trace("inner"))
+	app.Commands = []cli.Command{
+		{
+			Name: "remote",
+			Subcommands: []cli.Command{
+				{
+					Name: "add",
+					Action: func(c *cli.Context) {
+						calls = append(calls, c.Command.Name)
+					},
+				},
+			},
+		},
+	}
+
+	err := app.Run([]string{"command", "remote", "add"})
+	expect(t, err, nil)
+	expect(t, strings.Join(calls, ","), "outer before,inner before,add,inner after,outer after")
+}
+
+func TestAppRootCommand(t *testing.T) {
+	var ran string
+	var force, verbose bool
+	var args []string
+
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{Name: "verbose"},
+	}
+	app.RootCommand = &cli.Command{
+		Name: "copy",
+		Flags: []cli.Flag{
+			cli.BoolFlag{Name: "force, f"},
+		},
+		Action: func(c *cli.Context) {
+			ran = c.Command.Name
+			force = c.Bool("force")
+			verbose = c.GlobalBool("verbose")
+			args = c.Args()
+		},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "status",
+			Action: func(c *cli.Context) {
+				ran = c.Command.Name
+			},
+		},
+	}
+
+	err := app.Run([]string{"mytool", "--verbose", "-f", "a", "b"})
+	expect(t, err, nil)
+	expect(t, ran, "copy")
+	expect(t, force, true)
+	expect(t, verbose, true)
+	expect(t, strings.Join(args, " "), "a b")
+
+	err = app.Run([]string{"mytool", "a", "--force"})
+	expect(t, err, nil)
+	expect(t, ran, "copy")
+	expect(t, force, true)
+	expect(t, verbose, false)
+	expect(t, strings.Join(args, " "), "a")
+
+	err = app.Run([]string{"mytool"})
+	expect(t, err, nil)
+	expect(t, ran, "copy")
+	expect(t, force, false)
+	expect(t, len(args), 0)
+
+	err = app.Run([]string{"mytool", "status"})
+	expect(t, err, nil)
+	expect(t, ran, "status")
+
+	err = app.Run([]string{"mytool", "--bogus"})
+	expect(t, err.Error(), "flag provided but not defined: -bogus")
+}
+
+func ExampleApp_RootCommand_help() {
+	app := cli.NewApp()
+	app.RootCommand = &cli.Command{
+		Name:        "copy",
+		Usage:       "copy files",
+		ArgsUsage:   "<source> <dest>",
+		Description: "Copies the source file to the destination.",
+		Action:      func(c *cli.Context) {},
+	}
+
+	app.Run([]string{"mytool", "copy", "--help"})
+	// Output:
+	// NAME:
+	//    copy - copy files
+	//
+	// USAGE:
+	//    command copy [command options] <source> <dest>
+	//
+	// DESCRIPTION:
+	//    Copies the source file to the destination.
+	//
+	// OPTIONS:
+}
+
+func TestAppIsHelp(t *testing.T) {
+	help := captureHelp(t)
+
+	actionRun := false
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{Name: "usage"},
+	}
+	app.IsHelp = func(c *cli.Context) bool {
+		return cli.DefaultIsHelp(c) || c.Bool("usage")
+	}
+	app.IsVersion = func(c *cli.Context) bool {
+		return false
+	}
+	app.Action = func(c *cli.Context) {
+		actionRun = true
+	}
+
+	app.Run([]string{"command", "--usage"})
+	expect(t, len(help.templates), 1)
+	expect(t, help.templates[0], cli.AppHelpTemplate)
+
+	app.Run([]string{"command", "-h"})
+	expect(t, len(help.templates), 2)
+
+	app.Run([]string{"command", "--version"})
+	expect(t, actionRun, true)
+}
+
+func TestAppBufferedOutput(t *testing.T) {
+	var out bytes.Buffer
+	var during string
+
+	app := cli.NewApp()
+	app.Writer = &out
+	app.ErrWriter = ioutil.Discard
+	app.BufferedOutput = true
+	app.Before = func(c *cli.Context) error {
+		fmt.Fprintln(c.App.Writer, "before")
+		return nil
+	}
+	app.After = func(c *cli.Context) error {
+		fmt.Fprintln(c.App.Writer, "after")
+		return nil
+	}
+	app.Action = func(c *cli.Context) {
+		fmt.Fprintln(c.App.Writer, "line 1")
+		during = out.String()
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "fail",
+			Action: func(c *cli.Context) {
+				fmt.Fprintln(c.App.Writer, "partial")
+				cli.FuncAction(func() error { return errors.New("fail") })(c)
+			},
+		},
+	}
+
+	err := app.Run([]string{"command"})
+	expect(t, err, nil)
+	expect(t, during, "")
+	expect(t, out.String(), "before\nline 1\nafter\n")
+	expect(t, app.Writer, io.Writer(&out))
+
+	out.Reset()
+	err = app.Run([]string{"command", "fail"})
+	expect(t, err.Error(), "fail")
+	expect(t, out.String(), "before\npartial\nafter\n")
+}
+
+func TestAppAddAlias(t *testing.T) {
+	var long, all, reverse, verbose bool
+	var args []string
+
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{Name: "verbose"},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "list",
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "long"},
+				cli.BoolFlag{Name: "all"},
+				cli.BoolFlag{Name: "reverse, r"},
+			},
+			Action: func(c *cli.Context) {
+				long = c.Bool("long")
+				all = c.Bool("all")
+				reverse = c.Bool("r")
+				verbose = c.GlobalBool("verbose")
+				args = c.Args()
+			},
+		},
+	}
+	app.AddAlias("ll", "list", "--long", "--all")
+
+	err := app.Run([]string{"mytool", "--verbose", "ll", "-r", "dir"})
+	expect(t, err, nil)
+	expect(t, long, true)
+	expect(t, all, true)
+	expect(t, reverse, true)
+	expect(t, verbose, true)
+	expect(t, strings.Join(args, " "), "dir")
+
+	err = app.Run([]string{"mytool", "list"})
+	expect(t, err, nil)
+	expect(t, long, false)
+}
+
+func ExampleApp_completeMetadata() {
+	app := cli.NewApp()
+	app.Name = "mytool"
+	app.EnableBashCompletion = true
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "config, c", Usage: "the config file"},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:      "status",
+			ShortName: "s",
+			Usage:     "show the status",
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "short", Usage: "show less"},
+			},
+		},
+	}
+
+	app.Run([]string{"mytool", "__complete-metadata"})
+	// Output:
+	// {"version":1,"name":"mytool","flags":[{"names":["--config","-c"],"takesValue":true,"usage":"the config file"},{"names":["--version","-v"],"takesValue":false,"usage":"print the version"},{"names":["--help","-h"],"takesValue":false,"usage":"show help"}],"commands":[{"name":"status","aliases":["s"],"usage":"show the status","flags":[{"names":["--short"],"takesValue":false,"usage":"show less"}],"commands":[]},{"name":"help","aliases":["h"],"usage":"Shows a list of commands or help for one command","flags":[],"commands":[]}]}
+}
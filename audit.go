@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"strings"
+)
+
+// auditFlag is the resolved value of a flag in the audit log.
+type auditFlag struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// audit writes the given command path and the resolved flags of the context
+// and its parents, global flags first, to the AuditWriter of the app.
+func (a *App) audit(c *Context, command string) {
+	if a.AuditWriter == nil {
+		return
+	}
+
+	var contexts []*Context
+	for ctx := c; ctx != nil; ctx = ctx.parentContext {
+		contexts = append([]*Context{ctx}, contexts...)
+	}
+
+	flags := []auditFlag{}
+	seen := make(map[*flag.FlagSet]bool)
+	for _, ctx := range contexts {
+		if seen[ctx.flagSet] {
+			continue
+		}
+		seen[ctx.flagSet] = true
+
+		for _, f := range ctx.flags {
+			name := strings.TrimSpace(strings.Split(f.getName(), ",")[0])
+			ff := ctx.flagSet.Lookup(name)
+			if ff == nil || isBuiltinFlag(f) {
+				continue
+			}
+			value := ff.Value.String()
+			if isSensitive(f) {
+				value = "***"
+			}
+			flags = append(flags, auditFlag{name, value})
+		}
+	}
+
+	json.NewEncoder(a.AuditWriter).Encode(struct {
+		Command string      `json:"command"`
+		Flags   []auditFlag `json:"flags"`
+	}{command, flags})
+}
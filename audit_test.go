@@ -0,0 +1,32 @@
+package cli_test
+
+import (
+	"bytes"
+	"github.com/codegangsta/cli"
+	"testing"
+)
+
+func TestApp_AuditWriter(t *testing.T) {
+	var audit bytes.Buffer
+	app := cli.NewApp()
+	app.Name = "mytool"
+	app.AuditWriter = &audit
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "token", Sensitive: true},
+		cli.BoolFlag{Name: "verbose"},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "deploy",
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{Name: "region, r", Value: &cli.StringSlice{}},
+				cli.IntFlag{Name: "pin", Sensitive: true},
+			},
+			Action: func(c *cli.Context) {},
+		},
+	}
+
+	err := app.Run([]string{"mytool", "--token", "secret", "deploy", "-r", "eu", "--pin", "1234"})
+	expect(t, err, nil)
+	expect(t, audit.String(), `{"command":"mytool deploy","flags":[{"name":"token","value":"***"},{"name":"verbose","value":"false"},{"name":"region","value":"[eu]"},{"name":"pin","value":"***"}]}`+"\n")
+}
@@ -2,10 +2,31 @@ package cli
 
 import (
 	"fmt"
-	"io/ioutil"
-	"strings"
+	"os"
+	"time"
 )
 
+// ActionFunc is the signature of the actions of apps and commands.
+type ActionFunc func(context *Context)
+
+// FuncAction adapts a function that needs neither the context nor the
+// arguments to an action. If it returns an error, Run returns the error,
+// which RunAndExitOnError prints before exiting with OsExiter(1).
+func FuncAction(fn func() error) ActionFunc {
+	return func(c *Context) {
+		c.actionErr = fn()
+	}
+}
+
+// ArgsAction adapts a function that only needs the arguments to an action.
+// If it returns an error, Run returns the error, which RunAndExitOnError
+// prints before exiting with OsExiter(1).
+func ArgsAction(fn func(args []string) error) ActionFunc {
+	return func(c *Context) {
+		c.actionErr = fn(c.Args())
+	}
+}
+
 // Command is a subcommand for a cli.App.
 type Command struct {
 
@@ -18,16 +39,38 @@ type Command struct {
 	// Short description of the usage of this command
 	Usage string
 
+	// Usage of the arguments of the command, e.g. "<source> <dest>"
+	ArgsUsage string
+
 	// A longer explanation of how the command works
 	Description string
 
+	// Version of the command, if it is versioned independently of the app.
+	// Adds a --version flag to the command
+	Version string
+
+	// Text printed at the bottom of the help for this command
+	HelpFooter string
+
 	// The function to call when checking for bash command completions
 	BashComplete func(context *Context)
 
-	// An action to execute before any sub-subcommands are run, but after the context is ready
-	// If a non-nil error is returned, no sub-subcommands are run
+	// How long the completions printed by BashComplete and by the CompleteFunc
+	// of the flags are cached, see App.CompletionCacheDir. 0 disables the cache
+	CompletionCacheTTL time.Duration
+
+	// An action to execute before any sub-subcommands or the action are run, but after the context is ready
+	// If a non-nil error is returned, no sub-subcommands or action are run
 	Before func(context *Context) error
 
+	// Function to check the parsed flags and arguments, after the built-in
+	// checks and before Before and the action. If a non-nil error is
+	// returned, it is reported as a usage error and nothing is run
+	Validate func(context *Context) error
+
+	// An action to execute after any sub-subcommands or the action are run, but only if Before succeeded
+	After func(context *Context) error
+
 	// Function to call when this command is invoked
 	Action func(context *Context)
 
@@ -37,79 +80,293 @@ type Command struct {
 	// List of flags to parse
 	Flags []Flag
 
-	// Treat all flags as normal arguments if true
+	// Mutually exclusive modes of the command, each selected by a bool flag
+	// and with flags that can only be used in that mode
+	Modes []FlagMode
+
+	// Treat all flags as normal arguments if true, including --help and --
 	SkipFlagParsing bool
+
+	// Function to transform the arguments, e.g. to expand globs, before the
+	// action is run. If a non-nil error is returned, the action is not run
+	PreprocessArgs func(args []string) ([]string, error)
+
+	// Fail if any arguments are given besides flags
+	NoArgs bool
+
+	// Boolean to note in help that the command reads from standard input, and
+	// to warn that it waits for input when the Reader of the App is a terminal
+	ReadsStdin bool
+
+	// Function to check if the command can be run, e.g. only on some
+	// platforms. If it returns false, the command is hidden from help and
+	// running it fails
+	Available func(context *Context) bool
+
+	// Boolean to hide the command from help and completions
+	Hidden bool
+
+	// If set, the command is hidden from help and this message, which should
+	// point to the replacement of the command, is printed when it is run
+	Deprecated string
+
+	// The app that is run for this command, if it was mounted
+	app *App
+}
+
+// FlagMode is a mode of a command, selected by a bool flag. The flags of the
+// mode are listed under a heading of their own in help, and can only be used
+// together with the flag of the mode.
+type FlagMode struct {
+	// Name of the flag that selects the mode
+	Flag string
+
+	// Names of the flags that can only be used in the mode
+	Flags []string
 }
 
 // Run invokes the command, given the context.
 // It parses ctx.Args() to generate command-specific flags.
-func (c Command) Run(ctx *Context) error {
+func (c Command) Run(ctx *Context) (err error) {
+	if !c.available(ctx) {
+		return ctx.App.wrapError(ctx.App.Name+" "+c.Name, fmt.Errorf("Command '%v' is not available", c.Name))
+	}
+
+	if c.Deprecated != "" {
+		fmt.Fprintf(ctx.App.errWriter(), ctx.App.translate("Warning: command '%v' is deprecated: %s")+"\n", c.Name, c.Deprecated)
+	}
 
-	if len(c.Subcommands) > 0 || c.Before != nil {
+	if c.app != nil {
+		return c.runMounted(ctx)
+	}
+
+	if len(c.Subcommands) > 0 {
 		return c.startApp(ctx)
 	}
 
 	// append help to flags
 	c.Flags = append(
 		c.Flags,
-		BoolFlag{"help, h", "show help"},
+		ctx.App.translateUsage(helpFlag),
 	)
 
+	// commands without a version print the version of the app
+	hasVersion := (c.Version != "" || ctx.App.Version != "") && !c.definesFlag("version")
+	if hasVersion {
+		c.Flags = append(c.Flags, ctx.App.translateUsage(commandVersionFlag))
+	}
+
 	if ctx.App.EnableBashCompletion {
 		c.Flags = append(c.Flags, BashCompletionFlag)
 	}
 
-	set := flagSet(c.Name, c.Flags)
-	set.SetOutput(ioutil.Discard)
-
-	firstFlagIndex := -1
-	for index, arg := range ctx.Args() {
-		if strings.HasPrefix(arg, "-") {
-			firstFlagIndex = index
-			break
-		}
-	}
+	set := ctx.App.newFlagSet(c.Name, c.Flags)
 
-	var err error
-	if firstFlagIndex > -1 && !c.SkipFlagParsing {
-		args := ctx.Args()
-		regularArgs := args[1:firstFlagIndex]
-		flagArgs := args[firstFlagIndex:]
-		err = set.Parse(append(flagArgs, regularArgs...))
+	args := ctx.Args().Tail()
+	if c.SkipFlagParsing {
+		// keep all arguments, even those that look like flags
+		args = append([]string{"--"}, args...)
 	} else {
-		err = set.Parse(ctx.Args().Tail())
+		args = reorderArgs(set, ctx.App.normalizeArgs(set, args, false))
 	}
+	err = set.Parse(args)
 
 	if err != nil {
-		fmt.Println("Incorrect Usage.")
+		fmt.Println(ctx.App.translate("Incorrect Usage."))
 		fmt.Println()
 		ShowCommandHelp(ctx, c.Name)
 		fmt.Println()
-		return err
+		return ctx.App.wrapError(ctx.App.Name+" "+c.Name, err)
 	}
 
 	nerr := normalizeFlags(c.Flags, set)
+	if nerr == nil {
+		nerr = ctx.App.resolveFlags(c.Flags, set)
+	}
 	if nerr != nil {
 		fmt.Println(nerr)
 		fmt.Println()
 		ShowCommandHelp(ctx, c.Name)
 		fmt.Println()
-		return nerr
+		return ctx.App.wrapError(ctx.App.Name+" "+c.Name, nerr)
 	}
 	context := NewContext(ctx.App, set, ctx.globalSet)
+	context.Command = c
+	context.parentContext = ctx
+	context.flags = c.Flags
 
 	if checkCommandCompletions(context, c.Name) {
 		return nil
 	}
 
-	if checkCommandHelp(context, c.Name) {
+	// the name the command was run by, which may be its short name
+	name := ctx.Args().First()
+	if !c.HasName(name) {
+		name = c.Name
+	}
+	if checkCommandHelp(context, name) {
 		return nil
 	}
-	context.Command = c
-	c.Action(context)
+
+	if hasVersion && ctx.App.isVersion(context) {
+		ShowCommandVersion(context)
+		return nil
+	}
+
+	if merr := c.checkModes(context); merr != nil {
+		fmt.Println(merr)
+		fmt.Println()
+		ShowCommandHelp(ctx, c.Name)
+		fmt.Println()
+		return ctx.App.wrapError(ctx.App.Name+" "+c.Name, merr)
+	}
+
+	if c.NoArgs && context.Args().Present() {
+		aerr := fmt.Errorf("Command '%v' does not take arguments", c.Name)
+		fmt.Println(aerr)
+		fmt.Println()
+		ShowCommandHelp(ctx, c.Name)
+		fmt.Println()
+		return ctx.App.wrapError(ctx.App.Name+" "+c.Name, aerr)
+	}
+
+	if perr := context.preprocessArgs(ctx.App.PreprocessArgs, c.PreprocessArgs); perr != nil {
+		fmt.Println(perr)
+		fmt.Println()
+		ShowCommandHelp(ctx, c.Name)
+		fmt.Println()
+		return ctx.App.wrapError(ctx.App.Name+" "+c.Name, perr)
+	}
+
+	if c.Validate != nil {
+		if verr := c.Validate(context); verr != nil {
+			fmt.Println(verr)
+			fmt.Println()
+			ShowCommandHelp(ctx, c.Name)
+			fmt.Println()
+			return ctx.App.wrapError(ctx.App.Name+" "+c.Name, verr)
+		}
+	}
+
+	if f, ok := ctx.App.reader().(*os.File); ok && c.ReadsStdin && isTerminal(f) {
+		context.Warnf("%s", ctx.App.translate("waiting for input on standard input"))
+	}
+
+	if c.Before != nil {
+		if berr := c.Before(context); berr != nil {
+			return ctx.App.wrapError(ctx.App.Name+" "+c.Name, berr)
+		}
+	}
+
+	if c.After != nil {
+		defer func() {
+			if aerr := c.After(context); aerr != nil && err == nil {
+				err = ctx.App.wrapError(ctx.App.Name+" "+c.Name, aerr)
+			}
+		}()
+	}
+
+	ctx.App.audit(context, ctx.App.Name+" "+c.Name)
+	return ctx.App.wrapError(ctx.App.Name+" "+c.Name, ctx.App.runAction(c.Action, context))
+}
+
+// checkModes checks that the flags of at most one mode are set in the
+// context, and that the flags of a mode are only set with the flag of the mode.
+func (c Command) checkModes(ctx *Context) error {
+	var selected string
+	for _, mode := range c.Modes {
+		if !ctx.IsSet(mode.Flag) {
+			continue
+		}
+		if selected != "" {
+			return fmt.Errorf("%s%s cannot be used together with %s%s", prefixFor(selected), selected, prefixFor(mode.Flag), mode.Flag)
+		}
+		selected = mode.Flag
+	}
+
+	for _, mode := range c.Modes {
+		if mode.Flag == selected {
+			continue
+		}
+		for _, name := range mode.Flags {
+			if ctx.IsSet(name) {
+				return fmt.Errorf("%s%s can only be used with %s%s", prefixFor(name), name, prefixFor(mode.Flag), mode.Flag)
+			}
+		}
+	}
 	return nil
 }
 
+// selectedMode returns the index of the mode whose flag is set in the
+// context, or -1.
+func (c Command) selectedMode(ctx *Context) int {
+	for i, mode := range c.Modes {
+		if ctx.IsSet(mode.Flag) {
+			return i
+		}
+	}
+	return -1
+}
+
+// modeIndex returns the index of the mode the flag belongs to, or -1.
+func (c Command) modeIndex(f Flag) int {
+	for i, mode := range c.Modes {
+		for _, name := range mode.Flags {
+			found := false
+			eachName(f.getName(), func(n string) {
+				if n == name {
+					found = true
+				}
+			})
+			if found {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// definesFlag checks if the command or one of its subcommands has a flag with the given name.
+func (c Command) definesFlag(name string) bool {
+	return c.lookupFlag(name) != nil
+}
+
+// lookupFlag returns the flag with the given name of the command or one of
+// its subcommands, or nil if there is none.
+func (c Command) lookupFlag(name string) Flag {
+	for _, f := range c.Flags {
+		found := false
+		eachName(f.getName(), func(n string) {
+			if n == name {
+				found = true
+			}
+		})
+		if found {
+			return f
+		}
+	}
+	for _, sub := range c.Subcommands {
+		if f := sub.lookupFlag(name); f != nil {
+			return f
+		}
+	}
+	if c.app != nil {
+		mounted := Command{Flags: c.app.Flags, Subcommands: c.app.Commands}
+		return mounted.lookupFlag(name)
+	}
+	return nil
+}
+
+// visible checks if the command is listed in help and completions.
+func (c Command) visible(ctx *Context) bool {
+	return !c.Hidden && c.Deprecated == "" && c.available(ctx)
+}
+
+// available checks if the command can be run in the given context.
+func (c Command) available(ctx *Context) bool {
+	return c.Available == nil || c.Available(ctx)
+}
+
 // HasName returns true if Command.Name or Command.ShortName matches the given name.
 func (c Command) HasName(name string) bool {
 	return c.Name == name || c.ShortName == name
@@ -126,23 +383,51 @@ func (c Command) startApp(ctx *Context) error {
 		app.Usage = c.Usage
 	}
 
+	app.Version = c.Version
+	if app.Version == "" {
+		app.Version = ctx.App.Version
+	}
+	app.HelpFooter = c.HelpFooter
+
 	// set the flags and commands
 	app.Commands = c.Subcommands
 	app.Flags = c.Flags
 
-	// bash completion
-	app.EnableBashCompletion = ctx.App.EnableBashCompletion
+	app.inherit(ctx.App)
 	if c.BashComplete != nil {
 		app.BashComplete = c.BashComplete
 	}
 
 	// set the actions
+	app.Validate = c.Validate
 	app.Before = c.Before
+	app.After = c.After
 	if c.Action != nil {
 		app.Action = c.Action
 	} else {
 		app.Action = helpSubcommand.Action
 	}
 
-	return app.RunAsSubcommand(ctx)
+	// the context the command is run with
+	commandCtx := *ctx
+	commandCtx.Command = c
+
+	return app.RunAsSubcommand(&commandCtx)
+}
+
+// runMounted runs the mounted app with the arguments after the command name.
+func (c Command) runMounted(ctx *Context) error {
+	app := *c.app
+	app.Name = fmt.Sprintf("%s %s", ctx.App.Name, c.Name)
+
+	// the output and settings of the app it is mounted in, with the
+	// middlewares of the mounted app inside those of that app
+	app.inherit(ctx.App)
+	app.middlewares = append(append([]func(next ActionFunc) ActionFunc{}, ctx.App.middlewares...), c.app.middlewares...)
+
+	commandCtx := *ctx
+	commandCtx.Command = c
+	app.parent = &commandCtx
+
+	return app.Run(append([]string{app.Name}, ctx.Args().Tail()...))
 }
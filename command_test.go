@@ -1,8 +1,14 @@
 package cli_test
 
 import (
+	"bytes"
+	"errors"
 	"flag"
+	"fmt"
 	"github.com/codegangsta/cli"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -46,3 +52,567 @@ func TestCommandIgnoreFlags(t *testing.T) {
 
 	expect(t, err, nil)
 }
+
+func TestCommandWrapActionErrors(t *testing.T) {
+	beforeError := errors.New("fail")
+
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.WrapActionErrors = true
+	app.Commands = []cli.Command{
+		{
+			Name: "hello",
+			Subcommands: []cli.Command{
+				{
+					Name: "english",
+					Before: func(c *cli.Context) error {
+						return beforeError
+					},
+					Action: func(c *cli.Context) {},
+				},
+				{
+					Name:   "spanish",
+					Action: func(c *cli.Context) {},
+				},
+			},
+		},
+	}
+
+	err := app.Run([]string{"greet", "hello", "english"})
+	expect(t, err.Error(), "greet hello english: fail")
+	expect(t, errors.Is(err, beforeError), true)
+
+	err = app.Run([]string{"greet", "hello", "spanish", "-break"})
+	expect(t, err.Error(), "greet hello spanish: flag provided but not defined: -break")
+}
+
+func TestCommandDeprecated(t *testing.T) {
+	var stderr bytes.Buffer
+	commandRun := false
+
+	app := cli.NewApp()
+	app.ErrWriter = &stderr
+	app.Commands = []cli.Command{
+		{
+			Name:       "old",
+			Deprecated: "use 'new' instead",
+			Action: func(c *cli.Context) {
+				commandRun = true
+			},
+		},
+	}
+
+	err := app.Run([]string{"command", "old"})
+	expect(t, err, nil)
+	expect(t, commandRun, true)
+	expect(t, stderr.String(), "Warning: command 'old' is deprecated: use 'new' instead\n")
+}
+
+func TestCommandContextCommand(t *testing.T) {
+	var names []string
+	action := func(c *cli.Context) {
+		names = append(names, c.Command.Name)
+	}
+
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{Name: "plain", Action: action},
+		{
+			Name:   "before",
+			Before: func(c *cli.Context) error { return nil },
+			Action: action,
+		},
+		{
+			Name:        "parent",
+			Action:      action,
+			Subcommands: []cli.Command{{Name: "child", Action: action}},
+		},
+	}
+
+	app.Run([]string{"command", "plain"})
+	app.Run([]string{"command", "before"})
+	app.Run([]string{"command", "parent"})
+	app.Run([]string{"command", "parent", "child"})
+	expect(t, strings.Join(names, ","), "plain,before,parent,child")
+}
+
+func TestCommandNoArgs(t *testing.T) {
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{
+			Name:   "status",
+			NoArgs: true,
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "short"},
+			},
+			Action: func(c *cli.Context) {},
+		},
+	}
+
+	err := app.Run([]string{"command", "status", "--short"})
+	expect(t, err, nil)
+
+	err = app.Run([]string{"command", "status", "stray", "--short"})
+	expect(t, err.Error(), "Command 'status' does not take arguments")
+}
+
+func TestCommandLeafHooks(t *testing.T) {
+	var calls, got []string
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{
+			Name: "exec",
+			Before: func(c *cli.Context) error {
+				calls = append(calls, "before")
+				return nil
+			},
+			After: func(c *cli.Context) error {
+				calls = append(calls, "after")
+				return nil
+			},
+			SkipFlagParsing: true,
+			PreprocessArgs: func(args []string) ([]string, error) {
+				return append(args, "extra"), nil
+			},
+			Action: func(c *cli.Context) {
+				calls = append(calls, "action")
+				got = c.Args()
+			},
+		},
+		{
+			Name:   "status",
+			NoArgs: true,
+			After: func(c *cli.Context) error {
+				calls = append(calls, "status.after")
+				return nil
+			},
+			Action: func(c *cli.Context) {},
+		},
+	}
+
+	err := app.Run([]string{"command", "exec", "ls", "-l"})
+	expect(t, err, nil)
+	expect(t, strings.Join(calls, " "), "before action after")
+	expect(t, strings.Join(got, " "), "ls -l extra")
+
+	calls = nil
+	err = app.Run([]string{"command", "status", "stray"})
+	expect(t, err.Error(), "Command 'status' does not take arguments")
+	expect(t, len(calls), 0)
+}
+
+func TestCommandActionAdapters(t *testing.T) {
+	var removed []string
+	afterRun := false
+	app := cli.NewApp()
+	app.After = func(c *cli.Context) error {
+		afterRun = true
+		return nil
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "fail",
+			Action: cli.FuncAction(func() error {
+				return errors.New("fail")
+			}),
+		},
+		{
+			Name: "rm",
+			Action: cli.ArgsAction(func(args []string) error {
+				removed = args
+				return nil
+			}),
+		},
+	}
+
+	err := app.Run([]string{"command", "rm", "a", "b"})
+	expect(t, err, nil)
+	expect(t, strings.Join(removed, ","), "a,b")
+
+	// the error is returned, after the After hook ran
+	err = app.Run([]string{"command", "fail"})
+	expect(t, err.Error(), "fail")
+	expect(t, afterRun, true)
+}
+
+func TestCommandArgsTerminator(t *testing.T) {
+	var args []string
+	var opt string
+	var foo bool
+
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{
+			Name: "build",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "opt"},
+				cli.BoolFlag{Name: "foo"},
+			},
+			Action: func(c *cli.Context) {
+				args = c.Args()
+				opt = c.String("opt")
+				foo = c.Bool("foo")
+			},
+		},
+	}
+
+	// a terminator before the command only ends the global flags
+	err := app.Run([]string{"command", "--", "build", "--foo"})
+	expect(t, err, nil)
+	expect(t, foo, true)
+	expect(t, len(args), 0)
+
+	// a terminator after the command ends the flags of the command
+	err = app.Run([]string{"command", "build", "--", "--foo"})
+	expect(t, err, nil)
+	expect(t, foo, false)
+	expect(t, strings.Join(args, " "), "--foo")
+
+	// flags and arguments may be mixed, the order of the arguments is kept
+	err = app.Run([]string{"command", "build", "a", "--opt", "v", "b", "-", "--", "--foo", "c"})
+	expect(t, err, nil)
+	expect(t, opt, "v")
+	expect(t, foo, false)
+	expect(t, strings.Join(args, " "), "a b - --foo c")
+}
+
+func ExampleCommand_version() {
+	app := cli.NewApp()
+	app.Name = "mytool"
+	app.Version = "1.0.0"
+	app.Commands = []cli.Command{
+		{
+			Name:    "plugin",
+			Version: "0.3.1",
+			Action: func(c *cli.Context) {
+				fmt.Println("running plugin")
+			},
+		},
+		{
+			Name:    "remote",
+			Version: "2.0.0",
+			Subcommands: []cli.Command{
+				{Name: "add"},
+			},
+		},
+		{
+			Name:   "status",
+			Action: func(c *cli.Context) {},
+		},
+	}
+
+	app.Run([]string{"mytool", "plugin", "--version"})
+	app.Run([]string{"mytool", "remote", "--version"})
+	app.Run([]string{"mytool", "remote", "add", "--version"})
+	app.Run([]string{"mytool", "status", "--version"})
+	app.Run([]string{"mytool", "plugin"})
+	// Output:
+	// mytool plugin version 0.3.1
+	// mytool remote version 2.0.0
+	// mytool remote add version 2.0.0
+	// mytool status version 1.0.0
+	// running plugin
+}
+
+func TestCommandPreprocessArgs(t *testing.T) {
+	var args []string
+	app := cli.NewApp()
+	app.PreprocessArgs = func(args []string) ([]string, error) {
+		return append(args, "app"), nil
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "build",
+			PreprocessArgs: func(args []string) ([]string, error) {
+				if len(args) == 1 {
+					return nil, errors.New("No targets given")
+				}
+				return append(args, "build"), nil
+			},
+			Action: func(c *cli.Context) {
+				args = c.Args()
+			},
+		},
+	}
+
+	err := app.Run([]string{"command", "build", "a"})
+	expect(t, err, nil)
+	expect(t, strings.Join(args, " "), "a app build")
+
+	args = nil
+	err = app.Run([]string{"command", "build"})
+	expect(t, err.Error(), "No targets given")
+	expect(t, len(args), 0)
+}
+
+func TestCommandSkipFlagParsingPassThrough(t *testing.T) {
+	var args []string
+	app := cli.NewApp()
+	app.GlobalFlagsAnywhere = true
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{Name: "verbose"},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:            "exec",
+			SkipFlagParsing: true,
+			Action: func(c *cli.Context) {
+				args = c.Args()
+			},
+		},
+	}
+
+	err := app.Run([]string{"command", "exec", "ls", "-la", "--verbose", "--help"})
+	expect(t, err, nil)
+	expect(t, strings.Join(args, " "), "ls -la --verbose --help")
+
+	err = app.Run([]string{"command", "exec", "--", "-x"})
+	expect(t, err, nil)
+	expect(t, strings.Join(args, " "), "-- -x")
+}
+
+func TestCommandAvailable(t *testing.T) {
+	help := captureHelp(t)
+
+	serviceRun := false
+	app := cli.NewApp()
+	app.Name = "mytool"
+	app.Commands = []cli.Command{
+		{
+			Name: "windows-service",
+			Available: func(c *cli.Context) bool {
+				return false
+			},
+			Action: func(c *cli.Context) {
+				serviceRun = true
+			},
+		},
+		{
+			Name:   "status",
+			Action: func(c *cli.Context) {},
+		},
+	}
+
+	app.Run([]string{"mytool", "--help"})
+	var names []string
+	for _, c := range help.data[0].(*cli.App).Commands {
+		names = append(names, c.Name)
+	}
+	expect(t, strings.Join(names, ","), "status,help")
+
+	err := app.Run([]string{"mytool", "windows-service"})
+	expect(t, err.Error(), "Command 'windows-service' is not available")
+	expect(t, serviceRun, false)
+}
+
+func ExampleCommand_readsStdin() {
+	app := cli.NewApp()
+	app.Name = "mytool"
+	app.Commands = []cli.Command{
+		{
+			Name:        "sort",
+			Usage:       "sort lines",
+			Description: "Sorts the lines of the input.",
+			ReadsStdin:  true,
+			Action:      func(c *cli.Context) {},
+		},
+	}
+
+	app.Run([]string{"mytool", "help", "sort"})
+	// Output:
+	// NAME:
+	//    sort - sort lines
+	//
+	// USAGE:
+	//    command sort [command options] [arguments...]
+	//
+	// DESCRIPTION:
+	//    Sorts the lines of the input.
+	//    Reads from standard input.
+	//
+	// OPTIONS:
+}
+
+func TestCommandReadsStdinWarning(t *testing.T) {
+	var errOutput bytes.Buffer
+	app := cli.NewApp()
+	app.ErrWriter = &errOutput
+	app.Reader = strings.NewReader("b\na\n")
+	app.Commands = []cli.Command{
+		{
+			Name:       "sort",
+			ReadsStdin: true,
+			Action:     func(c *cli.Context) {},
+		},
+	}
+
+	err := app.Run([]string{"mytool", "sort"})
+	expect(t, err, nil)
+	expect(t, errOutput.String(), "")
+
+	terminal, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skip("no pseudo terminal:", err)
+	}
+	defer terminal.Close()
+	app.Reader = terminal
+
+	err = app.Run([]string{"mytool", "sort"})
+	expect(t, err, nil)
+	expect(t, errOutput.String(), "Warning: waiting for input on standard input\n")
+}
+
+func TestCommandValidate(t *testing.T) {
+	copied := false
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.IntFlag{Name: "jobs", Value: 1},
+	}
+	app.Validate = func(c *cli.Context) error {
+		if c.GlobalInt("jobs") < 1 {
+			return errors.New("--jobs must be at least 1")
+		}
+		return nil
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "copy",
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "recursive, r"},
+			},
+			Validate: func(c *cli.Context) error {
+				if len(c.Args()) < 2 {
+					return errors.New("copy needs a source and a destination")
+				}
+				return nil
+			},
+			Action: func(c *cli.Context) {
+				copied = true
+			},
+		},
+	}
+
+	err := app.Run([]string{"command", "copy", "a", "b"})
+	expect(t, err, nil)
+	expect(t, copied, true)
+
+	copied = false
+	err = app.Run([]string{"command", "copy", "-r", "a"})
+	expect(t, err.Error(), "copy needs a source and a destination")
+	expect(t, copied, false)
+
+	err = app.Run([]string{"command", "--jobs", "0", "copy", "a", "b"})
+	expect(t, err.Error(), "--jobs must be at least 1")
+	expect(t, copied, false)
+}
+
+func ExampleCommand_aliasHelp() {
+	app := cli.NewApp()
+	app.Name = "mytool"
+	app.Commands = []cli.Command{
+		{
+			Name:        "generate",
+			ShortName:   "g",
+			Usage:       "generate code",
+			Description: "Generates code from the schema.",
+			Action:      func(c *cli.Context) {},
+		},
+	}
+
+	app.Run([]string{"mytool", "g", "--help"})
+	// Output:
+	// 'g' is an alias for 'generate'
+	//
+	// NAME:
+	//    generate - generate code
+	//
+	// USAGE:
+	//    command generate [command options] [arguments...]
+	//
+	// DESCRIPTION:
+	//    Generates code from the schema.
+	//
+	// OPTIONS:
+}
+
+func ExampleApp_AddAlias_help() {
+	app := cli.NewApp()
+	app.Name = "mytool"
+	app.Commands = []cli.Command{
+		{
+			Name:        "generate",
+			Usage:       "generate code",
+			Description: "Generates code from the schema.",
+			Action:      func(c *cli.Context) {},
+		},
+	}
+	app.AddAlias("gen-all", "generate", "--all")
+
+	app.Run([]string{"mytool", "help", "gen-all"})
+	// Output:
+	// 'gen-all' is an alias for 'generate --all'
+	//
+	// NAME:
+	//    generate - generate code
+	//
+	// USAGE:
+	//    command generate [command options] [arguments...]
+	//
+	// DESCRIPTION:
+	//    Generates code from the schema.
+	//
+	// OPTIONS:
+}
+
+func TestCommandModes(t *testing.T) {
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{
+			Name: "export",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "output, o"},
+				cli.BoolFlag{Name: "archive"},
+				cli.StringFlag{Name: "compression, z", Value: "gzip"},
+				cli.BoolFlag{Name: "sync"},
+				cli.StringFlag{Name: "remote"},
+			},
+			Modes: []cli.FlagMode{
+				{Flag: "archive", Flags: []string{"compression"}},
+				{Flag: "sync", Flags: []string{"remote"}},
+			},
+			Action: func(c *cli.Context) {},
+		},
+	}
+
+	var groups []string
+	for _, group := range app.Command("export").FlagGroups() {
+		groups = append(groups, fmt.Sprintf("%s:%d", group.Name, len(group.Flags)))
+	}
+	expect(t, strings.Join(groups, ","), ":3,--archive mode (not with --sync):1,--sync mode (not with --archive):1")
+
+	err := app.Run([]string{"command", "export", "--archive", "-z", "xz"})
+	expect(t, err, nil)
+
+	err = app.Run([]string{"command", "export", "--archive", "--sync"})
+	expect(t, err.Error(), "--archive cannot be used together with --sync")
+
+	err = app.Run([]string{"command", "export", "--archive", "--remote", "origin"})
+	expect(t, err.Error(), "--remote can only be used with --sync")
+
+	// the help for a selected mode only shows the flags of that mode
+	out, err := ioutil.TempFile("", "cli-modes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+	stdout := os.Stdout
+	os.Stdout = out
+	app.Run([]string{"command", "export", "--sync", "--help"})
+	os.Stdout = stdout
+	out.Close()
+
+	help, _ := ioutil.ReadFile(out.Name())
+	expect(t, strings.Contains(string(help), "--sync mode:"), true)
+	expect(t, strings.Contains(string(help), "--remote"), true)
+	expect(t, strings.Contains(string(help), "--compression"), false)
+}
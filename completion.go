@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// completionCacheDir returns the directory the completion caches of the app
+// are stored in, or "" if there is none.
+func (a *App) completionCacheDir() string {
+	if a.CompletionCacheDir != "" {
+		return a.CompletionCacheDir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, a.baseName(), "completion")
+}
+
+// ClearCompletionCache removes the cached completions of the app.
+func (a *App) ClearCompletionCache() error {
+	dir := a.completionCacheDir()
+	if dir == "" {
+		return nil
+	}
+	return os.RemoveAll(dir)
+}
+
+// completeCached runs complete, which prints completions, and caches what it
+// prints under the given key. Within ttl, the cached completions are printed
+// instead of running complete again. A ttl of 0 disables the cache.
+func (a *App) completeCached(ttl time.Duration, key []string, complete func()) {
+	if ttl <= 0 {
+		complete()
+		return
+	}
+
+	dir := a.completionCacheDir()
+	if dir == "" {
+		a.traceCompletion("cannot cache the completions: no cache directory")
+		complete()
+		return
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(key, "\x00")))))
+	if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) < ttl {
+		if out, err := ioutil.ReadFile(path); err == nil {
+			a.traceCompletion("using the completions cached in %s", path)
+			os.Stdout.Write(out)
+			return
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		a.traceCompletion("cannot cache the completions: %v", err)
+		complete()
+		return
+	}
+	f, err := ioutil.TempFile(dir, "capture")
+	if err != nil {
+		a.traceCompletion("cannot cache the completions: %v", err)
+		complete()
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	captureStdout(f, complete)
+	f.Seek(0, 0)
+	out, err := ioutil.ReadAll(f)
+	os.Stdout.Write(out)
+	if err == nil {
+		err = ioutil.WriteFile(path, out, 0600)
+	}
+	if err != nil {
+		a.traceCompletion("cannot cache the completions: %v", err)
+	}
+}
+
+// captureStdout runs fn with os.Stdout replaced by f.
+func captureStdout(f *os.File, fn func()) {
+	stdout := os.Stdout
+	os.Stdout = f
+	defer func() {
+		os.Stdout = stdout
+	}()
+	fn()
+}
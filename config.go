@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"strings"
+)
+
+var configCommand = Command{
+	Name:  "config",
+	Usage: "Shows the resolved value of each global option",
+	Action: func(c *Context) {
+		table := c.NewTable("OPTION", "VALUE", "SOURCE")
+		for _, f := range c.App.Flags {
+			if isBuiltinFlag(f) {
+				continue
+			}
+
+			source := "default"
+			eachName(f.getName(), func(name string) {
+				if isSet(c.globalSet, name) {
+					source = "flag"
+				}
+			})
+
+			name := strings.TrimSpace(strings.Split(f.getName(), ",")[0])
+			value := lookupString(name, c.globalSet)
+			if isSensitive(f) {
+				value = "***"
+			}
+			table.Append(prefixFor(name)+name, value, source)
+		}
+		table.Flush()
+	},
+}
+
+// builtinFlags holds the names of the flags cli adds itself.
+var builtinFlags = flagNames(BashCompletionFlag, helpFlag, versionFlag, commandVersionFlag,
+	versionJSONFlag, outputFileFlag, dryRunFlag, cpuProfileFlag, memProfileFlag)
+
+// flagNames returns the set of the names of the given flags.
+func flagNames(flags ...Flag) map[string]bool {
+	names := make(map[string]bool, len(flags))
+	for _, f := range flags {
+		names[f.getName()] = true
+	}
+	return names
+}
+
+// isBuiltinFlag checks if the flag is one of the flags cli adds itself.
+func isBuiltinFlag(f Flag) bool {
+	return builtinFlags[f.getName()]
+}
@@ -0,0 +1,42 @@
+package cli_test
+
+import (
+	"bytes"
+	"github.com/codegangsta/cli"
+	"testing"
+)
+
+func TestApp_ConfigDumpCommand(t *testing.T) {
+	var buf bytes.Buffer
+
+	app := cli.NewApp()
+	app.Writer = &buf
+	app.EnableConfigDumpCommand = true
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "host", Value: "localhost"},
+		cli.IntFlag{Name: "port, p", Value: 80},
+		cli.StringFlag{Name: "token", Sensitive: true},
+	}
+
+	err := app.Run([]string{"command", "-p", "8080", "--token", "s3cret", "config"})
+	expect(t, err, nil)
+	expect(t, buf.String(), "OPTION   VALUE      SOURCE\n--host   localhost  default\n--port   8080       flag\n--token  ***        flag\n")
+}
+
+func TestConfigDumpCommandSkipsBuiltinFlags(t *testing.T) {
+	var buf bytes.Buffer
+	app := cli.NewApp()
+	app.Writer = &buf
+	app.EnableConfigDumpCommand = true
+	app.EnableOutputFileFlag = true
+	app.EnableDryRunFlag = true
+	app.EnableVersionJSON = true
+	app.EnableProfilingFlags = true
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "host", Value: "localhost"},
+	}
+
+	err := app.Run([]string{"command", "config"})
+	expect(t, err, nil)
+	expect(t, buf.String(), "OPTION  VALUE      SOURCE\n--host  localhost  default\n")
+}
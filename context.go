@@ -3,8 +3,11 @@ package cli
 import (
 	"errors"
 	"flag"
+	"fmt"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type (
@@ -13,11 +16,17 @@ type (
 	// Context is a type that is passed through to each Handler action in a cli application.
 	// Context can be used to retrieve context-specific Args and parsed command-line options.
 	Context struct {
-		App       *App
-		Command   Command
-		flagSet   *flag.FlagSet
-		globalSet *flag.FlagSet
-		setFlags  map[string]bool
+		App           *App
+		Command       Command
+		flagSet       *flag.FlagSet
+		globalSet     *flag.FlagSet
+		setFlags      map[string]bool
+		parentContext *Context
+		rawArgs       []string
+		args          Args
+		flags         []Flag
+		deferred      *[]func()
+		actionErr     error
 	}
 )
 
@@ -36,6 +45,29 @@ func (c *Context) Float64(name string) float64 {
 	return lookupFloat64(name, c.flagSet)
 }
 
+// Duration looks up the value of a local duration flag, returns 0 if no duration flag exists.
+func (c *Context) Duration(name string) time.Duration {
+	return lookupDuration(name, c.flagSet)
+}
+
+// IntE looks up the value of a local int flag like Int, but returns the error
+// if the value cannot be parsed. It returns 0 and no error if no such flag exists.
+func (c *Context) IntE(name string) (int, error) {
+	return lookupIntE(name, c.flagSet)
+}
+
+// Float64E looks up the value of a local float64 flag like Float64, but returns the
+// error if the value cannot be parsed. It returns 0 and no error if no such flag exists.
+func (c *Context) Float64E(name string) (float64, error) {
+	return lookupFloat64E(name, c.flagSet)
+}
+
+// DurationE looks up the value of a local duration flag like Duration, but returns the
+// error if the value cannot be parsed. It returns 0 and no error if no such flag exists.
+func (c *Context) DurationE(name string) (time.Duration, error) {
+	return lookupDurationE(name, c.flagSet)
+}
+
 // Bool looks up the value of a local bool flag, returns false if no bool flag exists.
 func (c *Context) Bool(name string) bool {
 	return lookupBool(name, c.flagSet)
@@ -63,27 +95,62 @@ func (c *Context) IntSlice(name string) []int {
 
 // GlobalInt looks up the value of a global int flag, returns 0 if no int flag exists
 func (c *Context) GlobalInt(name string) int {
-	return lookupInt(name, c.globalSet)
+	return lookupInt(name, c.globalFlagSet(name))
+}
+
+// GlobalDuration looks up the value of a global duration flag, returns 0 if no duration flag exists.
+func (c *Context) GlobalDuration(name string) time.Duration {
+	return lookupDuration(name, c.globalFlagSet(name))
+}
+
+// GlobalIntE looks up the value of a global int flag like GlobalInt, but returns the
+// error if the value cannot be parsed. It returns 0 and no error if no such flag exists.
+func (c *Context) GlobalIntE(name string) (int, error) {
+	return lookupIntE(name, c.globalFlagSet(name))
+}
+
+// GlobalDurationE looks up the value of a global duration flag like GlobalDuration, but
+// returns the error if the value cannot be parsed. It returns 0 and no error if no such
+// flag exists.
+func (c *Context) GlobalDurationE(name string) (time.Duration, error) {
+	return lookupDurationE(name, c.globalFlagSet(name))
 }
 
 // GlobalBool looks up the value of a global bool flag, returns false if no bool flag exists.
 func (c *Context) GlobalBool(name string) bool {
-	return lookupBool(name, c.globalSet)
+	return lookupBool(name, c.globalFlagSet(name))
+}
+
+// GlobalBoolT looks up the value of a global boolT flag, returns false if no bool flag exists.
+func (c *Context) GlobalBoolT(name string) bool {
+	return lookupBoolT(name, c.globalFlagSet(name))
 }
 
 // GlobalString looks up the value of a global string flag, returns "" if no string flag exists.
 func (c *Context) GlobalString(name string) string {
-	return lookupString(name, c.globalSet)
+	return lookupString(name, c.globalFlagSet(name))
 }
 
 // GlobalStringSlice looks up the value of a global string slice flag, returns nil if no string slice flag exists.
 func (c *Context) GlobalStringSlice(name string) []string {
-	return lookupStringSlice(name, c.globalSet)
+	return lookupStringSlice(name, c.globalFlagSet(name))
 }
 
 // GlobalIntSlice looks up the value of a global int slice flag, returns nil if no int slice flag exists.
 func (c *Context) GlobalIntSlice(name string) []int {
-	return lookupIntSlice(name, c.globalSet)
+	return lookupIntSlice(name, c.globalFlagSet(name))
+}
+
+// globalFlagSet returns the set of global flags that defines the named flag:
+// the one of the context, or else the first one of its parents that does, as
+// for an app that is mounted in another app.
+func (c *Context) globalFlagSet(name string) *flag.FlagSet {
+	for ctx := c; ctx != nil; ctx = ctx.parentContext {
+		if ctx.globalSet != nil && ctx.globalSet.Lookup(name) != nil {
+			return ctx.globalSet
+		}
+	}
+	return c.globalSet
 }
 
 // IsSet determines if the flag was actually set exists.
@@ -97,12 +164,138 @@ func (c *Context) IsSet(name string) bool {
 	return c.setFlags[name] == true
 }
 
+// RawArgs returns the arguments exactly as they were passed to App.Run.
+func (c *Context) RawArgs() []string {
+	for ctx := c; ctx != nil; ctx = ctx.parentContext {
+		if ctx.rawArgs != nil {
+			return append([]string(nil), ctx.rawArgs...)
+		}
+	}
+	return nil
+}
+
+// Interactive checks if the user can be asked for input. It returns false in
+// batch mode or if the Reader of the App is not a terminal.
+func (c *Context) Interactive() bool {
+	if c.App != nil && c.App.BatchMode {
+		return false
+	}
+	f, ok := c.App.reader().(*os.File)
+	return ok && isTerminal(f)
+}
+
+// ColorEnabled checks if output to the App's Writer should be colored. An
+// explicitly set global color flag takes precedence, followed by the NO_COLOR,
+// CLICOLOR_FORCE and FORCE_COLOR environment variables. Otherwise color is
+// enabled if the Writer is a terminal.
+func (c *Context) ColorEnabled() bool {
+	if f := c.globalSet.Lookup("color"); f != nil && isSet(c.globalSet, "color") {
+		switch f.Value.String() {
+		case "always", "true":
+			return true
+		case "never", "false":
+			return false
+		}
+	}
+
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	if force := os.Getenv("CLICOLOR_FORCE"); force != "" && force != "0" {
+		return true
+	}
+	if os.Getenv("FORCE_COLOR") != "" {
+		return true
+	}
+
+	f, ok := c.App.writer().(*os.File)
+	return ok && isTerminal(f)
+}
+
+// DryRun checks if the global dry-run flag is set, in which case commands
+// should only print what they would do.
+func (c *Context) DryRun() bool {
+	return c.GlobalBool("dry-run")
+}
+
+// Mutate calls fn, which has side effects described by description, unless
+// DryRun is true. In that case the description is printed to the Writer of
+// the App instead.
+func (c *Context) Mutate(description string, fn func() error) error {
+	if c.DryRun() {
+		fmt.Fprintf(c.App.writer(), c.App.translate("Would %s")+"\n", description)
+		return nil
+	}
+	return fn()
+}
+
+// Warnf prints a warning to the ErrWriter of the App, unless a local or global
+// quiet flag is set.
+func (c *Context) Warnf(format string, a ...interface{}) {
+	if c.Bool("quiet") || c.GlobalBool("quiet") {
+		return
+	}
+	fmt.Fprintf(c.App.errWriter(), c.App.translate("Warning: ")+format+"\n", a...)
+}
+
+// Defer registers fn to be run when the app is done, after the action and the
+// After hooks, also if they panic. The functions run in the reverse order of
+// registration, like deferred calls. Defer only has an effect while App.Run
+// runs the app.
+func (c *Context) Defer(fn func()) {
+	for ctx := c; ctx != nil; ctx = ctx.parentContext {
+		if ctx.deferred != nil {
+			*ctx.deferred = append(*ctx.deferred, fn)
+			return
+		}
+	}
+}
+
+// runDeferred runs the functions in reverse order, all of them even if one
+// of them panics.
+func runDeferred(fns []func()) {
+	for _, fn := range fns {
+		defer fn()
+	}
+}
+
 // Args returns the command line arguments associated with the context.
 func (c *Context) Args() Args {
+	if c.args != nil {
+		return c.args
+	}
 	args := Args(c.flagSet.Args())
 	return args
 }
 
+// preprocessArgs replaces the arguments of the context with the result of
+// passing them through the given functions, which may be nil.
+func (c *Context) preprocessArgs(fns ...func(args []string) ([]string, error)) error {
+	args := []string(c.Args())
+	for _, fn := range fns {
+		if fn == nil {
+			continue
+		}
+		var err error
+		if args, err = fn(args); err != nil {
+			return err
+		}
+	}
+	if args == nil {
+		args = []string{}
+	}
+	c.args = args
+	return nil
+}
+
+// ArgOr returns the nth argument, or fallback if there are not enough arguments.
+func (c *Context) ArgOr(n int, fallback string) string {
+	if args := c.Args(); len(args) > n {
+		return args[n]
+	}
+	return fallback
+}
+
 // Get returns the nth argument, or else a blank string.
 func (a Args) Get(n int) string {
 	if len(a) > n {
@@ -129,36 +322,148 @@ func (a Args) Present() bool {
 	return len(a) != 0
 }
 
+// Has checks if any of the arguments equals s.
+func (a Args) Has(s string) bool {
+	return a.Index(s) != -1
+}
+
+// Index returns the position of the first argument that equals s, or -1 if there is none.
+func (a Args) Index(s string) int {
+	for i, arg := range a {
+		if arg == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// Validate applies the nth validator to the nth argument. The errors are
+// combined into one error, which names the position and value of each
+// argument that failed.
+func (a Args) Validate(validators ...func(string) error) error {
+	var failures []string
+	for n, validate := range validators {
+		if len(a) <= n {
+			failures = append(failures, fmt.Sprintf("No argument at position %d", n))
+			continue
+		}
+		if err := validate(a[n]); err != nil {
+			failures = append(failures, fmt.Sprintf("Invalid argument '%s' at position %d: %v", a[n], n, err))
+		}
+	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "\n"))
+	}
+	return nil
+}
+
+// isSet checks if the named flag was set in the given flag set.
+func isSet(set *flag.FlagSet, name string) bool {
+	found := false
+	set.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+	return found
+}
+
+// isSetAny checks if the flag with the given comma separated names was set
+// in the given flag set by any of its names.
+func isSetAny(set *flag.FlagSet, names string) bool {
+	found := false
+	eachName(names, func(name string) {
+		found = found || isSet(set, name)
+	})
+	return found
+}
+
+// setValue sets the value of the flag with the given comma separated names
+// in set without marking the flag as set, so that IsSet keeps reporting only
+// the flags given in the arguments.
+func setValue(set *flag.FlagSet, names string, value string) error {
+	var err error
+	eachName(names, func(name string) {
+		if f := set.Lookup(name); f != nil && err == nil {
+			err = f.Value.Set(value)
+		}
+	})
+	return err
+}
+
 // lookupInt retrieves the Int value of a named flag.
 func lookupInt(name string, set *flag.FlagSet) int {
+	val, err := lookupIntE(name, set)
+	if err != nil {
+		return 0
+	}
+	return val
+}
+
+// lookupIntE retrieves the Int value of a named flag, or the error
+// parsing it.
+func lookupIntE(name string, set *flag.FlagSet) (int, error) {
 	f := set.Lookup(name)
 	// bail out if name is not found in set
 	if f == nil {
-		return 0
+		return 0, nil
 	}
-	// get the Int value
-	val, err := strconv.Atoi(f.Value.String())
+	// get the Int value, without parsing it again if the flag holds an int
+	if getter, ok := f.Value.(flag.Getter); ok {
+		if val, ok := getter.Get().(int); ok {
+			return val, nil
+		}
+	}
+	return strconv.Atoi(f.Value.String())
+}
+
+// lookupFloat64 retrieves the Float64 value of a named flag.
+func lookupFloat64(name string, set *flag.FlagSet) float64 {
+	val, err := lookupFloat64E(name, set)
 	if err != nil {
 		return 0
 	}
 	return val
 }
 
-// lookupFloat64 retrieves the Float64 value of a named flag.
-func lookupFloat64(name string, set *flag.FlagSet) float64 {
+// lookupFloat64E retrieves the Float64 value of a named flag, or the error
+// parsing it.
+func lookupFloat64E(name string, set *flag.FlagSet) (float64, error) {
 	f := set.Lookup(name)
 	// bail out if name is not found in set
 	if f == nil {
-		return 0
+		return 0, nil
+	}
+	// get the Float64 value, without parsing it again if the flag holds a float64
+	if getter, ok := f.Value.(flag.Getter); ok {
+		if val, ok := getter.Get().(float64); ok {
+			return val, nil
+		}
 	}
-	// get the Float64 value
-	val, err := strconv.ParseFloat(f.Value.String(), 64)
+	return strconv.ParseFloat(f.Value.String(), 64)
+}
+
+// lookupDuration retrieves the Duration value of a named flag.
+func lookupDuration(name string, set *flag.FlagSet) time.Duration {
+	val, err := lookupDurationE(name, set)
 	if err != nil {
 		return 0
 	}
 	return val
 }
 
+// lookupDurationE retrieves the Duration value of a named flag, or the error
+// parsing it.
+func lookupDurationE(name string, set *flag.FlagSet) (time.Duration, error) {
+	f := set.Lookup(name)
+	// bail out if name is not found in set
+	if f == nil {
+		return 0, nil
+	}
+	// get the Duration value
+	return time.ParseDuration(f.Value.String())
+}
+
 // lookupString retrieves the String value of a named flag.
 func lookupString(name string, set *flag.FlagSet) string {
 	f := set.Lookup(name)
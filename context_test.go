@@ -1,8 +1,14 @@
 package cli_test
 
 import (
+	"bytes"
+	"errors"
 	"flag"
 	"github.com/codegangsta/cli"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -26,6 +32,48 @@ func TestContext_Int(t *testing.T) {
 	expect(t, c.Int("myflag"), 12)
 }
 
+func TestContext_IntChanged(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	set.Int("myflag", 12, "doc")
+	set.Float64("otherflag", 1.5, "doc")
+	c := cli.NewContext(nil, set, set)
+	expect(t, c.Int("myflag"), 12)
+	expect(t, c.GlobalInt("myflag"), 12)
+	expect(t, c.Float64("otherflag"), 1.5)
+	set.Set("myflag", "13")
+	set.Set("otherflag", "2.5")
+	expect(t, c.Int("myflag"), 13)
+	expect(t, c.GlobalInt("myflag"), 13)
+	expect(t, c.Float64("otherflag"), 2.5)
+	expect(t, c.Int("bogusflag"), 0)
+}
+
+func TestContext_IntE(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	set.Int("myflag", 12, "doc")
+	set.String("badflag", "twelve", "doc")
+	set.String("timeout", "soon", "doc")
+	c := cli.NewContext(nil, set, set)
+
+	i, err := c.IntE("myflag")
+	expect(t, i, 12)
+	expect(t, err, nil)
+
+	i, err = c.IntE("missing")
+	expect(t, i, 0)
+	expect(t, err, nil)
+
+	_, err = c.IntE("badflag")
+	expect(t, err.Error(), `strconv.Atoi: parsing "twelve": invalid syntax`)
+	expect(t, c.Int("badflag"), 0)
+
+	_, err = c.Float64E("badflag")
+	expect(t, errors.Is(err, strconv.ErrSyntax), true)
+
+	_, err = c.GlobalDurationE("timeout")
+	expect(t, err.Error(), `time: invalid duration "soon"`)
+}
+
 func TestContext_String(t *testing.T) {
 	set := flag.NewFlagSet("test", 0)
 	set.String("myflag", "hello world", "doc")
@@ -47,6 +95,27 @@ func TestContext_BoolT(t *testing.T) {
 	expect(t, c.BoolT("myflag"), true)
 }
 
+func TestContext_GlobalBoolT(t *testing.T) {
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.BoolTFlag{Name: "color"},
+	}
+	var color bool
+	app.Commands = []cli.Command{
+		{
+			Name: "show",
+			Action: func(c *cli.Context) {
+				color = c.GlobalBoolT("color")
+			},
+		},
+	}
+
+	app.Run([]string{"command", "show"})
+	expect(t, color, true)
+	app.Run([]string{"command", "--color=false", "show"})
+	expect(t, color, false)
+}
+
 func TestContext_Args(t *testing.T) {
 	set := flag.NewFlagSet("test", 0)
 	set.Bool("myflag", false, "doc")
@@ -66,3 +135,218 @@ func TestContext_IsSet(t *testing.T) {
 	expect(t, c.IsSet("otherflag"), false)
 	expect(t, c.IsSet("bogusflag"), false)
 }
+
+func TestContext_ArgsHas(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	c := cli.NewContext(nil, set, set)
+	set.Parse([]string{"bat", "baz", "baz"})
+	expect(t, c.Args().Has("baz"), true)
+	expect(t, c.Args().Has("foo"), false)
+	expect(t, c.Args().Index("bat"), 0)
+	expect(t, c.Args().Index("baz"), 1)
+	expect(t, c.Args().Index("foo"), -1)
+}
+
+func TestContext_ArgOr(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	c := cli.NewContext(nil, set, set)
+	set.Parse([]string{"serve", ""})
+	expect(t, c.ArgOr(0, "run"), "serve")
+	expect(t, c.ArgOr(1, "8080"), "")
+	expect(t, c.ArgOr(2, "8080"), "8080")
+}
+
+func TestContext_ArgsValidate(t *testing.T) {
+	positive := func(s string) error {
+		if n, err := strconv.Atoi(s); err != nil || n <= 0 {
+			return errors.New("not a positive integer")
+		}
+		return nil
+	}
+	nonEmpty := func(s string) error {
+		if s == "" {
+			return errors.New("empty")
+		}
+		return nil
+	}
+
+	set := flag.NewFlagSet("test", 0)
+	c := cli.NewContext(nil, set, set)
+	set.Parse([]string{"http://example.com", "3"})
+	expect(t, c.Args().Validate(nonEmpty, positive), nil)
+
+	set.Parse([]string{"", "-1"})
+	err := c.Args().Validate(nonEmpty, positive, nonEmpty)
+	expect(t, err.Error(), "Invalid argument '' at position 0: empty\nInvalid argument '-1' at position 1: not a positive integer\nNo argument at position 2")
+}
+
+func TestContext_Warnf(t *testing.T) {
+	var warnings bytes.Buffer
+	app := cli.NewApp()
+	app.ErrWriter = &warnings
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{Name: "quiet, q"},
+	}
+	app.Action = func(c *cli.Context) {
+		c.Warnf("%d files skipped", 2)
+	}
+
+	app.Run([]string{"command"})
+	expect(t, warnings.String(), "Warning: 2 files skipped\n")
+
+	warnings.Reset()
+	app.Run([]string{"command", "-q"})
+	expect(t, warnings.String(), "")
+}
+
+func TestContext_DryRun(t *testing.T) {
+	var output bytes.Buffer
+	deleted := false
+	app := cli.NewApp()
+	app.Writer = &output
+	app.EnableDryRunFlag = true
+	app.Commands = []cli.Command{
+		{
+			Name: "clean",
+			Action: func(c *cli.Context) {
+				c.Mutate("delete build/", func() error {
+					deleted = true
+					return nil
+				})
+			},
+		},
+	}
+
+	app.Run([]string{"command", "--dry-run", "clean"})
+	expect(t, deleted, false)
+	expect(t, output.String(), "Would delete build/\n")
+
+	output.Reset()
+	app.Run([]string{"command", "clean"})
+	expect(t, deleted, true)
+	expect(t, output.String(), "")
+}
+
+func TestContext_Interactive(t *testing.T) {
+	app := cli.NewApp()
+	app.BatchMode = true
+	set := flag.NewFlagSet("test", 0)
+	c := cli.NewContext(app, set, set)
+	expect(t, c.Interactive(), false)
+
+	// /dev/null is a character device, but not a terminal
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	app.BatchMode = false
+	app.Reader = devNull
+	expect(t, c.Interactive(), false)
+
+	app.Reader = strings.NewReader("piped")
+	expect(t, c.Interactive(), false)
+
+	terminal, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skip("no pseudo terminal:", err)
+	}
+	defer terminal.Close()
+	app.Reader = terminal
+	expect(t, c.Interactive(), true)
+}
+
+func TestContext_RawArgs(t *testing.T) {
+	var rawArgs []string
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{Name: "verbose"},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "hello",
+			Subcommands: []cli.Command{
+				{
+					Name: "english",
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: "name"},
+					},
+					Action: func(c *cli.Context) {
+						rawArgs = c.RawArgs()
+					},
+				},
+			},
+		},
+	}
+
+	args := []string{"greet", "--verbose", "hello", "english", "Bob", "--name", "Jeremy"}
+	app.Run(args)
+	expect(t, reflect.DeepEqual(rawArgs, args), true)
+}
+
+func TestContext_ColorEnabled(t *testing.T) {
+	for _, key := range []string{"NO_COLOR", "CLICOLOR_FORCE", "FORCE_COLOR"} {
+		defer os.Setenv(key, os.Getenv(key))
+		os.Unsetenv(key)
+	}
+
+	set := flag.NewFlagSet("test", 0)
+	set.String("color", "auto", "doc")
+	c := cli.NewContext(nil, set, set)
+
+	// output is not a terminal while testing
+	expect(t, c.ColorEnabled(), false)
+
+	os.Setenv("CLICOLOR_FORCE", "1")
+	expect(t, c.ColorEnabled(), true)
+
+	os.Setenv("NO_COLOR", "1")
+	expect(t, c.ColorEnabled(), false)
+
+	set.Parse([]string{"--color", "always"})
+	expect(t, c.ColorEnabled(), true)
+}
+
+func TestContext_Defer(t *testing.T) {
+	var calls []string
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{
+			Name: "remote",
+			After: func(c *cli.Context) error {
+				calls = append(calls, "after")
+				return nil
+			},
+			Subcommands: []cli.Command{
+				{
+					Name: "sync",
+					Action: func(c *cli.Context) {
+						c.Defer(func() { calls = append(calls, "close file") })
+						c.Defer(func() { calls = append(calls, "close connection") })
+						calls = append(calls, "action")
+					},
+				},
+				{
+					Name: "crash",
+					Action: func(c *cli.Context) {
+						c.Defer(func() { calls = append(calls, "cleanup") })
+						panic("crash")
+					},
+				},
+			},
+		},
+	}
+
+	err := app.Run([]string{"command", "remote", "sync"})
+	expect(t, err, nil)
+	expect(t, strings.Join(calls, ","), "action,after,close connection,close file")
+
+	calls = nil
+	func() {
+		defer func() {
+			refute(t, recover(), nil)
+		}()
+		app.Run([]string{"command", "remote", "crash"})
+	}()
+	expect(t, strings.Join(calls, ","), "after,cleanup")
+}
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConfigDir returns the directory for the configuration of the app, named
+// after the app in $XDG_CONFIG_HOME or ~/.config, in ~/Library/Application
+// Support on macOS and in %AppData% on Windows. The directory is created if
+// it does not exist.
+func (a *App) ConfigDir() (string, error) {
+	return appDir(os.UserConfigDir, a.baseName())
+}
+
+// CacheDir returns the directory for the cached data of the app, named after
+// the app in $XDG_CACHE_HOME or ~/.cache, in ~/Library/Caches on macOS and in
+// %LocalAppData% on Windows. The directory is created if it does not exist.
+func (a *App) CacheDir() (string, error) {
+	return appDir(os.UserCacheDir, a.baseName())
+}
+
+// appDir creates the directory with the given name in the directory returned
+// by base.
+func appDir(base func() (string, error), name string) (string, error) {
+	dir, err := base()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// baseName returns the name of the program of the app, without the path and
+// the names of the commands of subcommand apps.
+func (a *App) baseName() string {
+	name := strings.Fields(a.Name)
+	if len(name) == 0 {
+		return "cli"
+	}
+	return strings.TrimSuffix(filepath.Base(name[0]), ".exe")
+}
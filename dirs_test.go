@@ -0,0 +1,47 @@
+package cli_test
+
+import (
+	"github.com/codegangsta/cli"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestApp_ConfigDir(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the XDG variables are only used on Linux")
+	}
+
+	dir, err := ioutil.TempDir("", "cli-dirs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"XDG_CONFIG_HOME", "XDG_CACHE_HOME"} {
+		old, ok := os.LookupEnv(name)
+		os.Setenv(name, filepath.Join(dir, name))
+		if ok {
+			defer os.Setenv(name, old)
+		} else {
+			defer os.Unsetenv(name)
+		}
+	}
+
+	app := cli.NewApp()
+	app.Name = "/usr/bin/mytool"
+
+	config, err := app.ConfigDir()
+	expect(t, err, nil)
+	expect(t, config, filepath.Join(dir, "XDG_CONFIG_HOME", "mytool"))
+
+	cache, err := app.CacheDir()
+	expect(t, err, nil)
+	expect(t, cache, filepath.Join(dir, "XDG_CACHE_HOME", "mytool"))
+
+	info, err := os.Stat(cache)
+	expect(t, err, nil)
+	expect(t, info.IsDir(), true)
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ToDOT writes the tree of the commands of the app as a Graphviz DOT graph,
+// with a node for every command and an edge from every command to each of
+// its subcommands.
+func (a *App) ToDOT(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	root := a.baseName()
+	fmt.Fprintf(b, "digraph %s {\n", strconv.Quote(root))
+	fmt.Fprintf(b, "\t%s [label=%s];\n", strconv.Quote(root), strconv.Quote(root))
+	writeDOTCommands(b, root, a.Commands)
+	fmt.Fprintln(b, "}")
+	return b.Flush()
+}
+
+// writeDOTCommands writes the nodes of the given commands, whose parent has
+// the given path, and the edges to them, followed by their subcommands.
+func writeDOTCommands(w io.Writer, parent string, commands []Command) {
+	for _, c := range commands {
+		path := parent + " " + c.Name
+		fmt.Fprintf(w, "\t%s [label=%s];\n", strconv.Quote(path), strconv.Quote(c.Name))
+		fmt.Fprintf(w, "\t%s -> %s;\n", strconv.Quote(parent), strconv.Quote(path))
+
+		subcommands := c.Subcommands
+		if c.app != nil {
+			subcommands = c.app.Commands
+		}
+		writeDOTCommands(w, path, subcommands)
+	}
+}
@@ -0,0 +1,38 @@
+package cli_test
+
+import (
+	"bytes"
+	"github.com/codegangsta/cli"
+	"testing"
+)
+
+func TestApp_ToDOT(t *testing.T) {
+	app := cli.NewApp()
+	app.Name = "mytool"
+	app.Commands = []cli.Command{
+		{
+			Name: "remote",
+			Subcommands: []cli.Command{
+				{Name: "add"},
+				{Name: "remove"},
+			},
+		},
+		{Name: "status"},
+	}
+
+	var buf bytes.Buffer
+	err := app.ToDOT(&buf)
+	expect(t, err, nil)
+	expect(t, buf.String(), `digraph "mytool" {
+	"mytool" [label="mytool"];
+	"mytool remote" [label="remote"];
+	"mytool" -> "mytool remote";
+	"mytool remote add" [label="add"];
+	"mytool remote" -> "mytool remote add";
+	"mytool remote remove" [label="remove"];
+	"mytool remote" -> "mytool remote remove";
+	"mytool status" [label="status"];
+	"mytool" -> "mytool status";
+}
+`)
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LoadDotEnv reads KEY=value lines from the given .env file into the process
+// environment. Blank lines and lines starting with # are ignored, and values
+// may be quoted. Variables that are already set are kept, unless
+// DotEnvOverride is set.
+func (a *App) LoadDotEnv(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, err := parseDotEnvLine(strings.TrimPrefix(line, "export "))
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+
+		if _, exists := os.LookupEnv(key); exists && !a.DotEnvOverride {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// parseDotEnvLine splits a KEY=value line and unquotes the value.
+func parseDotEnvLine(line string) (key, value string, err error) {
+	i := strings.Index(line, "=")
+	if i < 1 {
+		return "", "", fmt.Errorf("expected KEY=value, got %q", line)
+	}
+	key = strings.TrimSpace(line[:i])
+	value = strings.TrimSpace(line[i+1:])
+
+	switch {
+	case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+		value, err = strconv.Unquote(value)
+	case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+		value = value[1 : len(value)-1]
+	default:
+		// strip trailing comments from unquoted values
+		if j := strings.Index(value, " #"); j != -1 {
+			value = strings.TrimSpace(value[:j])
+		}
+	}
+	return key, value, err
+}
@@ -0,0 +1,44 @@
+package cli_test
+
+import (
+	"github.com/codegangsta/cli"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestApp_LoadDotEnv(t *testing.T) {
+	file, err := ioutil.TempFile("", "cli-dotenv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`# comment
+
+CLI_TEST_PLAIN=plain value # comment
+export CLI_TEST_DOUBLE="quoted\nvalue"
+CLI_TEST_SINGLE='single # quoted'
+CLI_TEST_EXISTING=from file
+`)
+	file.Close()
+
+	os.Setenv("CLI_TEST_EXISTING", "from env")
+	defer func() {
+		for _, key := range []string{"CLI_TEST_PLAIN", "CLI_TEST_DOUBLE", "CLI_TEST_SINGLE", "CLI_TEST_EXISTING"} {
+			os.Unsetenv(key)
+		}
+	}()
+
+	app := cli.NewApp()
+	err = app.LoadDotEnv(file.Name())
+	expect(t, err, nil)
+	expect(t, os.Getenv("CLI_TEST_PLAIN"), "plain value")
+	expect(t, os.Getenv("CLI_TEST_DOUBLE"), "quoted\nvalue")
+	expect(t, os.Getenv("CLI_TEST_SINGLE"), "single # quoted")
+	expect(t, os.Getenv("CLI_TEST_EXISTING"), "from env")
+
+	app.DotEnvOverride = true
+	err = app.LoadDotEnv(file.Name())
+	expect(t, err, nil)
+	expect(t, os.Getenv("CLI_TEST_EXISTING"), "from file")
+}
@@ -3,8 +3,12 @@ package cli
 import (
 	"flag"
 	"fmt"
+	"math"
+	"os"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
 )
 
 type (
@@ -17,64 +21,158 @@ type (
 		// Apply Flag settings to the given flag set
 		Apply(*flag.FlagSet)
 		getName() string
+		// Names of the commands the flag applies to, all commands if empty
+		appliesTo() []string
+	}
+
+	// sensitiveFlag is implemented by flags whose values may be secret.
+	sensitiveFlag interface {
+		Flag
+		sensitive() bool
+	}
+
+	// groupedFlag is implemented by flags that can be listed under a heading
+	// in help.
+	groupedFlag interface {
+		Flag
+		group() string
+	}
+
+	// computedFlag is implemented by flags whose default value may be
+	// computed by a function, which is only called if the flag is not set.
+	computedFlag interface {
+		Flag
+		computeDefault() (string, bool)
+	}
+
+	// completingFlag is implemented by flags that can complete their values.
+	completingFlag interface {
+		Flag
+		completeFunc() func(c *Context, prefix string) []string
 	}
 
 	StringSlice []string
 
 	StringSliceFlag struct {
-		Name  string
-		Value *StringSlice
-		Usage string
+		Name         string
+		Value        *StringSlice
+		Usage        string
+		AppliesTo    []string
+		Sensitive    bool
+		Group        string
+		CompleteFunc func(c *Context, prefix string) []string
 	}
 
 	IntSlice []int
 
 	IntSliceFlag struct {
-		Name  string
-		Value *IntSlice
-		Usage string
+		Name      string
+		Value     *IntSlice
+		Usage     string
+		AppliesTo []string
+		Sensitive bool
+		Group     string
 	}
 
 	BoolFlag struct {
-		Name  string
-		Usage string
+		Name      string
+		Usage     string
+		AppliesTo []string
+		Sensitive bool
+		Group     string
 	}
 
 	// Same structure
 	BoolTFlag BoolFlag
 
 	StringFlag struct {
-		Name  string
-		Value string
-		Usage string
+		Name             string
+		Value            string
+		Usage            string
+		AppliesTo        []string
+		Sensitive        bool
+		Group            string
+		DefaultFunc      func() string
+		MustExist        bool
+		MustBeDir        bool
+		MustBeFile       bool
+		DeprecatedValues map[string]string
+		CompleteFunc     func(c *Context, prefix string) []string
 	}
 
 	IntFlag struct {
-		Name  string
-		Value int
-		Usage string
+		Name        string
+		Value       int
+		Usage       string
+		AppliesTo   []string
+		Sensitive   bool
+		Group       string
+		DefaultFunc func() int
 	}
 
 	Float64Flag struct {
-		Name  string
-		Value float64
-		Usage string
+		Name        string
+		Value       float64
+		Usage       string
+		AppliesTo   []string
+		Sensitive   bool
+		Group       string
+		DefaultFunc func() float64
+	}
+
+	DurationFlag struct {
+		Name        string
+		Value       time.Duration
+		Usage       string
+		AppliesTo   []string
+		Sensitive   bool
+		Group       string
+		DefaultUnit time.Duration
 	}
 )
 
 // This flag enables bash-completion for all commands and subcommands
-var BashCompletionFlag = BoolFlag{"generate-bash-completion", ""}
+var BashCompletionFlag = BoolFlag{Name: "generate-bash-completion"}
+
+// The other flags cli adds itself, whose usages are translated when they are
+// added
+var (
+	helpFlag           = BoolFlag{Name: "help, h", Usage: "show help"}
+	versionFlag        = BoolFlag{Name: "version, v", Usage: "print the version"}
+	commandVersionFlag = BoolFlag{Name: "version", Usage: "print the version"}
+	versionJSONFlag    = BoolFlag{Name: "version-json", Usage: "print the version as JSON"}
+	outputFileFlag     = StringFlag{Name: "output-file, O", Usage: "write the output to a file"}
+	dryRunFlag         = BoolFlag{Name: "dry-run", Usage: "show what would be done without doing it"}
+	cpuProfileFlag     = StringFlag{Name: "cpuprofile", Usage: "write a CPU profile to the file"}
+	memProfileFlag     = StringFlag{Name: "memprofile", Usage: "write a memory profile to the file"}
+)
 
 // Utility functions
 
-func flagSet(name string, flags []Flag) *flag.FlagSet {
-	set := flag.NewFlagSet(name, flag.ContinueOnError)
+func flagSet(name string, flags []Flag, errorHandling flag.ErrorHandling) *flag.FlagSet {
+	set := flag.NewFlagSet(name, errorHandling)
 	for _, f := range flags {
 		f.Apply(set)
 	}
 	return set
 }
 
+// withDefaults appends the default values of a slice flag to its usage,
+// separated by commas.
+func withDefaults(usage string, defaults []string) string {
+	if len(defaults) == 0 {
+		return usage
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s (default: %s)", usage, strings.Join(defaults, ",")))
+}
+
+// isSensitive checks if the value of the flag may be secret, so it must not
+// be printed or logged.
+func isSensitive(f Flag) bool {
+	sf, ok := f.(sensitiveFlag)
+	return ok && sf.sensitive()
+}
+
 func eachName(longName string, fn func(string)) {
 	parts := strings.Split(longName, ",")
 	for _, name := range parts {
@@ -102,6 +200,214 @@ func prefixedNames(fullName string) (prefixed string) {
 	return
 }
 
+// flagName returns the name of the flag given in arg, and whether arg also
+// holds the value of the flag. The name is empty if arg is not a flag.
+func flagName(arg string) (name string, hasValue bool) {
+	if len(arg) < 2 || arg[0] != '-' {
+		return "", false
+	}
+	name = arg[1:]
+	if name[0] == '-' {
+		name = name[1:]
+	}
+	if len(name) == 0 || name[0] == '-' || name[0] == '=' {
+		return "", false
+	}
+	if i := strings.Index(name, "="); i != -1 {
+		return name[:i], true
+	}
+	return name, false
+}
+
+// isBoolFlag checks if the given flag can be set without a value.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface {
+		IsBoolFlag() bool
+	})
+	return ok && b.IsBoolFlag()
+}
+
+// validateFlags checks that the paths given to string flags with MustExist,
+// MustBeDir or MustBeFile exist and are of the right kind.
+func validateFlags(flags []Flag, set *flag.FlagSet) error {
+	for _, f := range flags {
+		sf, ok := f.(StringFlag)
+		if !ok || !(sf.MustExist || sf.MustBeDir || sf.MustBeFile) {
+			continue
+		}
+		name := strings.TrimSpace(strings.Split(sf.Name, ",")[0])
+		path := lookupString(name, set)
+		// skip flags that are not given or whose value is being completed
+		if path == "" || path == "--"+BashCompletionFlag.Name {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		switch {
+		case os.IsNotExist(err):
+			return fmt.Errorf("Path '%s' given for %s%s does not exist", path, prefixFor(name), name)
+		case err != nil:
+			return fmt.Errorf("Cannot access path '%s' given for %s%s: %v", path, prefixFor(name), name, err)
+		case sf.MustBeDir && !info.IsDir():
+			return fmt.Errorf("Path '%s' given for %s%s is not a directory", path, prefixFor(name), name)
+		case sf.MustBeFile && !info.Mode().IsRegular():
+			return fmt.Errorf("Path '%s' given for %s%s is not a file", path, prefixFor(name), name)
+		}
+	}
+	return nil
+}
+
+// reorderArgs moves the flags in args, including their values, in front of
+// the positional arguments, keeping the order of both. Everything after a
+// "--" terminator is kept as positional arguments, verbatim. A "--" is put
+// between the flags and the positional arguments so that the flag set does
+// not parse positional arguments starting with "-".
+func reorderArgs(set *flag.FlagSet, args []string) []string {
+	var flags, positionals []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			positionals = append(positionals, args[i+1:]...)
+			break
+		}
+
+		name, hasValue := flagName(arg)
+		if name == "" {
+			positionals = append(positionals, arg)
+			continue
+		}
+
+		flags = append(flags, arg)
+		f := set.Lookup(name)
+		if f != nil && !hasValue && !isBoolFlag(f) && i+1 < len(args) {
+			i++
+			flags = append(flags, args[i])
+		}
+	}
+
+	if len(positionals) == 0 {
+		return flags
+	}
+	return append(append(flags, "--"), positionals...)
+}
+
+// rewriteFlagArgs replaces the name of every flag in args with fn(name).
+// Flag values and the arguments after a "--" terminator are left untouched.
+// If stopAtPositional is true, the arguments after the first positional
+// argument are left untouched as well.
+func rewriteFlagArgs(set *flag.FlagSet, args []string, stopAtPositional bool, fn func(string) string) []string {
+	rewritten := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(rewritten, args[i:]...)
+		}
+
+		name, hasValue := flagName(arg)
+		if name == "" {
+			if stopAtPositional {
+				return append(rewritten, args[i:]...)
+			}
+			rewritten = append(rewritten, arg)
+			continue
+		}
+
+		newName := fn(name)
+		pos := strings.Index(arg, name)
+		rewritten = append(rewritten, arg[:pos]+newName+arg[pos+len(name):])
+
+		// skip the value of the flag
+		f := set.Lookup(newName)
+		if f != nil && !hasValue && !isBoolFlag(f) && i+1 < len(args) {
+			i++
+			rewritten = append(rewritten, args[i])
+		}
+	}
+	return rewritten
+}
+
+// kebabCase converts a camelCase name to kebab-case. A run of capitals is
+// one word, so userID becomes user-id and HTTPProxy becomes http-proxy.
+func kebabCase(name string) string {
+	in := []rune(name)
+	runes := make([]rune, 0, len(in))
+	for i, r := range in {
+		if unicode.IsUpper(r) {
+			if i > 0 && (!unicode.IsUpper(in[i-1]) || (i+1 < len(in) && unicode.IsLower(in[i+1]))) {
+				runes = append(runes, '-')
+			}
+			r = unicode.ToLower(r)
+		}
+		runes = append(runes, r)
+	}
+	return string(runes)
+}
+
+// kebabCaseNames converts the long names in a comma separated list of flag
+// names to kebab-case. Single letter names are left alone.
+func kebabCaseNames(names string) string {
+	var converted []string
+	eachName(names, func(name string) {
+		if len(name) > 1 {
+			name = kebabCase(name)
+		}
+		converted = append(converted, name)
+	})
+	return strings.Join(converted, ", ")
+}
+
+// kebabCaseFlags returns copies of the flags with their names converted to
+// kebab-case. Flags of other types than the ones cli provides are kept as is.
+func kebabCaseFlags(flags []Flag) []Flag {
+	converted := make([]Flag, len(flags))
+	for i, f := range flags {
+		switch ff := f.(type) {
+		case StringSliceFlag:
+			ff.Name = kebabCaseNames(ff.Name)
+			f = ff
+		case IntSliceFlag:
+			ff.Name = kebabCaseNames(ff.Name)
+			f = ff
+		case BoolFlag:
+			ff.Name = kebabCaseNames(ff.Name)
+			f = ff
+		case BoolTFlag:
+			ff.Name = kebabCaseNames(ff.Name)
+			f = ff
+		case StringFlag:
+			ff.Name = kebabCaseNames(ff.Name)
+			f = ff
+		case IntFlag:
+			ff.Name = kebabCaseNames(ff.Name)
+			f = ff
+		case Float64Flag:
+			ff.Name = kebabCaseNames(ff.Name)
+			f = ff
+		case DurationFlag:
+			ff.Name = kebabCaseNames(ff.Name)
+			f = ff
+		}
+		converted[i] = f
+	}
+	return converted
+}
+
+// matchFlagName returns the name of the flag in set that name refers to,
+// treating the camelCase and kebab-case spellings of a name as the same.
+func matchFlagName(set *flag.FlagSet, name string) string {
+	if set.Lookup(name) != nil {
+		return name
+	}
+	match := name
+	normalized := kebabCase(name)
+	set.VisitAll(func(f *flag.Flag) {
+		if kebabCase(f.Name) == normalized {
+			match = f.Name
+		}
+	})
+	return match
+}
+
 // --- StringSlice ---
 
 func (f *StringSlice) Set(value string) error {
@@ -122,7 +428,11 @@ func (f *StringSlice) Value() []string {
 func (f StringSliceFlag) String() string {
 	firstName := strings.Trim(strings.Split(f.Name, ",")[0], " ")
 	pref := prefixFor(firstName)
-	return fmt.Sprintf("%s '%v'\t%v", prefixedNames(f.Name), pref+firstName+" option "+pref+firstName+" option", f.Usage)
+	var defaults []string
+	if f.Value != nil {
+		defaults = f.Value.Value()
+	}
+	return fmt.Sprintf("%s '%v'\t%v", prefixedNames(f.Name), pref+firstName+" option "+pref+firstName+" option", withDefaults(f.Usage, defaults))
 }
 
 func (f StringSliceFlag) Apply(set *flag.FlagSet) {
@@ -135,6 +445,52 @@ func (f StringSliceFlag) getName() string {
 	return f.Name
 }
 
+func (f StringSliceFlag) appliesTo() []string {
+	return f.AppliesTo
+}
+
+func (f StringSliceFlag) sensitive() bool {
+	return f.Sensitive
+}
+
+func (f StringSliceFlag) group() string {
+	return f.Group
+}
+
+func (f StringSliceFlag) completeFunc() func(c *Context, prefix string) []string {
+	return f.CompleteFunc
+}
+
+// --- boolValue ---
+
+// boolValue is the flag.Value of bool flags. Besides the values accepted by
+// strconv.ParseBool, it accepts yes, no, on and off in any case.
+type boolValue bool
+
+func (b *boolValue) Set(value string) error {
+	switch strings.ToLower(value) {
+	case "yes", "on":
+		*b = true
+	case "no", "off":
+		*b = false
+	default:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*b = boolValue(v)
+	}
+	return nil
+}
+
+func (b *boolValue) String() string {
+	return strconv.FormatBool(bool(*b))
+}
+
+func (b *boolValue) IsBoolFlag() bool {
+	return true
+}
+
 // --- IntSlice ---
 
 func (f *IntSlice) Set(value string) error {
@@ -161,7 +517,13 @@ func (f *IntSlice) Value() []int {
 func (f IntSliceFlag) String() string {
 	firstName := strings.Trim(strings.Split(f.Name, ",")[0], " ")
 	pref := prefixFor(firstName)
-	return fmt.Sprintf("%s '%v'\t%v", prefixedNames(f.Name), pref+firstName+" option "+pref+firstName+" option", f.Usage)
+	var defaults []string
+	if f.Value != nil {
+		for _, i := range f.Value.Value() {
+			defaults = append(defaults, strconv.Itoa(i))
+		}
+	}
+	return fmt.Sprintf("%s '%v'\t%v", prefixedNames(f.Name), pref+firstName+" option "+pref+firstName+" option", withDefaults(f.Usage, defaults))
 }
 
 func (f IntSliceFlag) Apply(set *flag.FlagSet) {
@@ -174,6 +536,18 @@ func (f IntSliceFlag) getName() string {
 	return f.Name
 }
 
+func (f IntSliceFlag) appliesTo() []string {
+	return f.AppliesTo
+}
+
+func (f IntSliceFlag) sensitive() bool {
+	return f.Sensitive
+}
+
+func (f IntSliceFlag) group() string {
+	return f.Group
+}
+
 // --- BoolFlag ---
 
 func (f BoolFlag) String() string {
@@ -182,7 +556,8 @@ func (f BoolFlag) String() string {
 
 func (f BoolFlag) Apply(set *flag.FlagSet) {
 	eachName(f.Name, func(name string) {
-		set.Bool(name, false, f.Usage)
+		value := boolValue(false)
+		set.Var(&value, name, f.Usage)
 	})
 }
 
@@ -190,6 +565,18 @@ func (f BoolFlag) getName() string {
 	return f.Name
 }
 
+func (f BoolFlag) appliesTo() []string {
+	return f.AppliesTo
+}
+
+func (f BoolFlag) sensitive() bool {
+	return f.Sensitive
+}
+
+func (f BoolFlag) group() string {
+	return f.Group
+}
+
 // --- BoolTFlag ---
 
 func (f BoolTFlag) String() string {
@@ -198,7 +585,8 @@ func (f BoolTFlag) String() string {
 
 func (f BoolTFlag) Apply(set *flag.FlagSet) {
 	eachName(f.Name, func(name string) {
-		set.Bool(name, true, f.Usage)
+		value := boolValue(true)
+		set.Var(&value, name, f.Usage)
 	})
 }
 
@@ -206,9 +594,25 @@ func (f BoolTFlag) getName() string {
 	return f.Name
 }
 
+func (f BoolTFlag) appliesTo() []string {
+	return f.AppliesTo
+}
+
+func (f BoolTFlag) sensitive() bool {
+	return f.Sensitive
+}
+
+func (f BoolTFlag) group() string {
+	return f.Group
+}
+
 // --- StringFlag ---
 
 func (f StringFlag) String() string {
+	if f.DefaultFunc != nil {
+		return fmt.Sprintf("%s (computed)\t%v", prefixedNames(f.Name), f.Usage)
+	}
+
 	var fmtString string
 	fmtString = "%s %v\t%v"
 
@@ -227,13 +631,39 @@ func (f StringFlag) Apply(set *flag.FlagSet) {
 	})
 }
 
+func (f StringFlag) computeDefault() (string, bool) {
+	if f.DefaultFunc == nil {
+		return "", false
+	}
+	return f.DefaultFunc(), true
+}
+
 func (f StringFlag) getName() string {
 	return f.Name
 }
 
+func (f StringFlag) appliesTo() []string {
+	return f.AppliesTo
+}
+
+func (f StringFlag) sensitive() bool {
+	return f.Sensitive
+}
+
+func (f StringFlag) group() string {
+	return f.Group
+}
+
+func (f StringFlag) completeFunc() func(c *Context, prefix string) []string {
+	return f.CompleteFunc
+}
+
 // --- IntFlag ---
 
 func (f IntFlag) String() string {
+	if f.DefaultFunc != nil {
+		return fmt.Sprintf("%s (computed)\t%v", prefixedNames(f.Name), f.Usage)
+	}
 	return fmt.Sprintf("%s '%v'\t%v", prefixedNames(f.Name), f.Value, f.Usage)
 }
 
@@ -243,13 +673,35 @@ func (f IntFlag) Apply(set *flag.FlagSet) {
 	})
 }
 
+func (f IntFlag) computeDefault() (string, bool) {
+	if f.DefaultFunc == nil {
+		return "", false
+	}
+	return strconv.Itoa(f.DefaultFunc()), true
+}
+
 func (f IntFlag) getName() string {
 	return f.Name
 }
 
+func (f IntFlag) appliesTo() []string {
+	return f.AppliesTo
+}
+
+func (f IntFlag) sensitive() bool {
+	return f.Sensitive
+}
+
+func (f IntFlag) group() string {
+	return f.Group
+}
+
 // --- Float64Flag ---
 
 func (f Float64Flag) String() string {
+	if f.DefaultFunc != nil {
+		return fmt.Sprintf("%s (computed)\t%v", prefixedNames(f.Name), f.Usage)
+	}
 	return fmt.Sprintf("%s '%v'\t%v", prefixedNames(f.Name), f.Value, f.Usage)
 }
 
@@ -259,6 +711,108 @@ func (f Float64Flag) Apply(set *flag.FlagSet) {
 	})
 }
 
+func (f Float64Flag) computeDefault() (string, bool) {
+	if f.DefaultFunc == nil {
+		return "", false
+	}
+	return strconv.FormatFloat(f.DefaultFunc(), 'g', -1, 64), true
+}
+
 func (f Float64Flag) getName() string {
 	return f.Name
 }
+
+func (f Float64Flag) appliesTo() []string {
+	return f.AppliesTo
+}
+
+func (f Float64Flag) sensitive() bool {
+	return f.Sensitive
+}
+
+func (f Float64Flag) group() string {
+	return f.Group
+}
+
+// --- DurationFlag ---
+
+func (f DurationFlag) String() string {
+	usage := f.Usage
+	if f.DefaultUnit != 0 {
+		usage = strings.TrimSpace(fmt.Sprintf("%v (default unit: %s)", usage, unitName(f.DefaultUnit)))
+	}
+	return fmt.Sprintf("%s '%v'\t%v", prefixedNames(f.Name), f.Value, usage)
+}
+
+func (f DurationFlag) Apply(set *flag.FlagSet) {
+	eachName(f.Name, func(name string) {
+		set.Var(&durationValue{f.Value, f.DefaultUnit}, name, f.Usage)
+	})
+}
+
+func (f DurationFlag) getName() string {
+	return f.Name
+}
+
+func (f DurationFlag) appliesTo() []string {
+	return f.AppliesTo
+}
+
+func (f DurationFlag) sensitive() bool {
+	return f.Sensitive
+}
+
+func (f DurationFlag) group() string {
+	return f.Group
+}
+
+// unitName returns the suffix of the given unit in duration strings.
+func unitName(unit time.Duration) string {
+	switch unit {
+	case time.Nanosecond:
+		return "ns"
+	case time.Microsecond:
+		return "us"
+	case time.Millisecond:
+		return "ms"
+	case time.Second:
+		return "s"
+	case time.Minute:
+		return "m"
+	case time.Hour:
+		return "h"
+	}
+	return unit.String()
+}
+
+// durationValue is the flag.Value of duration flags. If unit is set, a number
+// without a unit is a number of units, otherwise it must be a duration
+// string like "1m30s".
+type durationValue struct {
+	value time.Duration
+	unit  time.Duration
+}
+
+func (d *durationValue) Set(value string) error {
+	if d.unit != 0 {
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			// reject inf, NaN and numbers that overflow a time.Duration
+			v := n * float64(d.unit)
+			if math.IsNaN(v) || v >= math.MaxInt64 || v < math.MinInt64 {
+				return fmt.Errorf("invalid duration %q", value)
+			}
+			d.value = time.Duration(v)
+			return nil
+		}
+	}
+	v, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	d.value = v
+	return nil
+}
+
+func (d *durationValue) String() string {
+	return d.value.String()
+}
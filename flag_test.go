@@ -1,9 +1,15 @@
 package cli_test
 
 import (
+	"bytes"
+	"fmt"
 	"github.com/codegangsta/cli"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 )
 
 var (
@@ -74,6 +80,17 @@ func TestFloat64FlagHelpOutput(t *testing.T) {
 	}
 }
 
+func TestSliceFlagHelpOutput(t *testing.T) {
+	flag := cli.StringSliceFlag{Name: "tag, t", Value: &cli.StringSlice{"a", "b"}, Usage: "tags to add"}
+	expect(t, flag.String(), "--tag, -t '--tag option --tag option'\ttags to add (default: a,b)")
+
+	flag = cli.StringSliceFlag{Name: "tag", Value: &cli.StringSlice{}, Usage: "tags to add"}
+	expect(t, flag.String(), "--tag '--tag option --tag option'\ttags to add")
+
+	intFlag := cli.IntSliceFlag{Name: "port", Value: &cli.IntSlice{80, 443}}
+	expect(t, intFlag.String(), "--port '--port option --port option'\t(default: 80,443)")
+}
+
 func TestParseMultiString(t *testing.T) {
 	(&cli.App{
 		Flags: []cli.Flag{
@@ -106,6 +123,26 @@ func TestParseMultiStringSlice(t *testing.T) {
 	}).Run([]string{"run", "-s", "10", "-s", "20"})
 }
 
+func TestParseSliceOrderAndDuplicates(t *testing.T) {
+	var headers []string
+	var ports []int
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.StringSliceFlag{Name: "header, H", Value: &cli.StringSlice{}},
+			cli.IntSliceFlag{Name: "port", Value: &cli.IntSlice{}},
+		},
+		Action: func(ctx *cli.Context) {
+			headers = ctx.StringSlice("header")
+			ports = ctx.IntSlice("port")
+		},
+	}
+
+	err := a.Run([]string{"run", "-H", "Accept: b", "-H", "Accept: a", "-H", "Accept: b", "--port", "2", "--port", "1", "--port", "2"})
+	expect(t, err, nil)
+	expect(t, reflect.DeepEqual(headers, []string{"Accept: b", "Accept: a", "Accept: b"}), true)
+	expect(t, reflect.DeepEqual(ports, []int{2, 1, 2}), true)
+}
+
 func TestParseMultiInt(t *testing.T) {
 	a := cli.App{
 		Flags: []cli.Flag{
@@ -139,3 +176,473 @@ func TestParseMultiBool(t *testing.T) {
 	}
 	a.Run([]string{"run", "--serve"})
 }
+
+func TestParseNormalizedFlagNames(t *testing.T) {
+	var dryRun bool
+	var logLevel string
+
+	app := cli.NewApp()
+	app.EnableFlagNameNormalization = true
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{Name: "dry-run"},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "build",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "log-level"},
+			},
+			Action: func(c *cli.Context) {
+				dryRun = c.GlobalBool("dry-run")
+				logLevel = c.String("log-level")
+			},
+		},
+	}
+
+	err := app.Run([]string{"run", "--dryRun", "build", "arg", "--logLevel", "--dryRun"})
+	expect(t, err, nil)
+	expect(t, dryRun, true)
+	expect(t, logLevel, "--dryRun")
+
+	err = app.Run([]string{"run", "build", "--logLevel=debug"})
+	expect(t, err, nil)
+	expect(t, logLevel, "debug")
+}
+
+var kebabCaseTests = []struct {
+	name     string
+	expected string
+}{
+	{"dryRun", "dry-run"},
+	{"UserID", "user-id"},
+	{"userID", "user-id"},
+	{"HTTPProxy", "http-proxy"},
+	{"useHTTPProxy", "use-http-proxy"},
+	{"apiURL", "api-url"},
+	{"log-level", "log-level"},
+}
+
+func TestParseNormalizedFlagNamesAcronyms(t *testing.T) {
+	for _, test := range kebabCaseTests {
+		var value string
+		app := cli.NewApp()
+		app.EnableFlagNameNormalization = true
+		app.Flags = []cli.Flag{
+			cli.StringFlag{Name: test.name},
+		}
+		app.Action = func(c *cli.Context) {
+			value = c.String(test.expected)
+		}
+
+		err := app.Run([]string{"run", "--" + test.expected, "x"})
+		expect(t, err, nil)
+		expect(t, value, "x")
+		expect(t, app.Flags[0].String(), "--"+test.expected+" \t")
+	}
+}
+
+func TestParseNormalizedFlagNamesCamelCase(t *testing.T) {
+	var dryRun bool
+	var logLevel string
+
+	app := cli.NewApp()
+	app.EnableFlagNameNormalization = true
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{Name: "dryRun, n"},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "build",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "logLevel"},
+			},
+			Action: func(c *cli.Context) {
+				dryRun = c.GlobalBool("dry-run")
+				logLevel = c.String("log-level")
+			},
+		},
+	}
+
+	err := app.Run([]string{"run", "--dryRun", "build", "--log-level", "debug"})
+	expect(t, err, nil)
+	expect(t, dryRun, true)
+	expect(t, logLevel, "debug")
+	expect(t, app.Flags[0].String(), "--dry-run, -n\t")
+	expect(t, app.Command("build").Flags[0].String(), "--log-level \t")
+}
+
+func TestParseCaseInsensitiveFlagNames(t *testing.T) {
+	var verbose bool
+	var port int
+	var args []string
+
+	app := cli.NewApp()
+	app.CaseInsensitiveFlags = true
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{Name: "verbose"},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "serve",
+			Flags: []cli.Flag{
+				cli.IntFlag{Name: "port"},
+				cli.StringFlag{Name: "Root"},
+			},
+			Action: func(c *cli.Context) {
+				verbose = c.GlobalBool("verbose")
+				port = c.Int("port")
+				args = c.Args()
+			},
+		},
+	}
+
+	err := app.Run([]string{"run", "--Verbose", "serve", "--PORT=8080", "--Root", "SRC", "DIR"})
+	expect(t, err, nil)
+	expect(t, verbose, true)
+	expect(t, port, 8080)
+	expect(t, reflect.DeepEqual(args, []string{"DIR"}), true)
+}
+
+func TestFlagDefaultFunc(t *testing.T) {
+	os.Setenv("CLI_TEST_CACHE_HOME", "/tmp/cache")
+	defer os.Unsetenv("CLI_TEST_CACHE_HOME")
+
+	calls := 0
+	cacheDir := cli.StringFlag{
+		Name: "cache-dir",
+		DefaultFunc: func() string {
+			calls++
+			return os.Getenv("CLI_TEST_CACHE_HOME") + "/greet"
+		},
+	}
+	expect(t, cacheDir.String(), "--cache-dir (computed)\t")
+
+	var parsedDir string
+	var parsedJobs int
+	a := cli.App{
+		Flags: []cli.Flag{
+			cacheDir,
+			cli.IntFlag{Name: "jobs", DefaultFunc: func() int { return 4 }},
+		},
+		Action: func(ctx *cli.Context) {
+			parsedDir = ctx.String("cache-dir")
+			parsedJobs = ctx.Int("jobs")
+		},
+	}
+	a.Run([]string{"run"})
+	expect(t, parsedDir, "/tmp/cache/greet")
+	expect(t, parsedJobs, 4)
+	expect(t, calls, 1)
+
+	a.Run([]string{"run", "--cache-dir", "/var/cache", "--jobs", "2"})
+	expect(t, parsedDir, "/var/cache")
+	expect(t, parsedJobs, 2)
+	expect(t, calls, 1)
+}
+
+func TestParseNegativeNumberValues(t *testing.T) {
+	var offset int
+	var scale float64
+	var firstArg string
+
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.IntFlag{Name: "offset, o"},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "resize",
+			Flags: []cli.Flag{
+				cli.Float64Flag{Name: "scale, s"},
+			},
+			Action: func(c *cli.Context) {
+				offset = c.GlobalInt("offset")
+				scale = c.Float64("scale")
+				firstArg = c.Args().First()
+			},
+		},
+	}
+
+	err := app.Run([]string{"run", "--offset", "-5", "resize", "--scale", "-1.5"})
+	expect(t, err, nil)
+	expect(t, offset, -5)
+	expect(t, scale, -1.5)
+
+	err = app.Run([]string{"run", "-o", "-7", "resize", "image.png", "-s", "-0.5"})
+	expect(t, err, nil)
+	expect(t, offset, -7)
+	expect(t, scale, -0.5)
+	expect(t, firstArg, "image.png")
+}
+
+func TestStringFlagPathChecks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	expect(t, err, nil)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.yml")
+	expect(t, ioutil.WriteFile(file, nil, 0644), nil)
+	missing := filepath.Join(dir, "missing")
+
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "config, c", MustExist: true},
+			cli.StringFlag{Name: "data", MustBeDir: true},
+			cli.StringFlag{Name: "input", MustBeFile: true},
+		},
+		Action: func(ctx *cli.Context) {},
+	}
+
+	expect(t, a.Run([]string{"run"}), nil)
+	expect(t, a.Run([]string{"run", "-c", file, "--data", dir, "--input", file}), nil)
+
+	err = a.Run([]string{"run", "-c", missing})
+	expect(t, err.Error(), "Path '"+missing+"' given for --config does not exist")
+
+	err = a.Run([]string{"run", "--data", file})
+	expect(t, err.Error(), "Path '"+file+"' given for --data is not a directory")
+
+	err = a.Run([]string{"run", "--input", dir})
+	expect(t, err.Error(), "Path '"+dir+"' given for --input is not a file")
+}
+
+func TestStringFlagDeprecatedValues(t *testing.T) {
+	var warnings bytes.Buffer
+	var format string
+	a := cli.App{
+		ErrWriter: &warnings,
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "format, f", Value: "json", DeprecatedValues: map[string]string{"xml": "json"}},
+		},
+		Action: func(ctx *cli.Context) {
+			format = ctx.String("f")
+		},
+	}
+
+	expect(t, a.Run([]string{"run", "--format", "yaml"}), nil)
+	expect(t, format, "yaml")
+	expect(t, warnings.String(), "")
+
+	expect(t, a.Run([]string{"run", "-f", "xml"}), nil)
+	expect(t, format, "json")
+	expect(t, warnings.String(), "Warning: value 'xml' of --format is deprecated, using 'json' instead\n")
+}
+
+func TestStringFlagDeprecatedDefault(t *testing.T) {
+	var warnings bytes.Buffer
+	var formatSet bool
+	a := cli.App{
+		ErrWriter: &warnings,
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "format", Value: "xml", DeprecatedValues: map[string]string{"xml": "json"}},
+			cli.StringFlag{Name: "other"},
+		},
+		RequireExactlyOne: [][]string{{"format", "other"}},
+		Action: func(ctx *cli.Context) {
+			formatSet = ctx.IsSet("format")
+		},
+	}
+
+	expect(t, a.Run([]string{"run", "--other", "y"}), nil)
+	expect(t, formatSet, false)
+	expect(t, warnings.String(), "")
+}
+
+func TestParseBoolWords(t *testing.T) {
+	var verbose, color bool
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.BoolFlag{Name: "verbose"},
+			cli.BoolTFlag{Name: "color"},
+		},
+		Action: func(ctx *cli.Context) {
+			verbose = ctx.Bool("verbose")
+			color = ctx.BoolT("color")
+		},
+	}
+
+	expect(t, a.Run([]string{"run", "--verbose=yes", "--color=Off"}), nil)
+	expect(t, verbose, true)
+	expect(t, color, false)
+
+	expect(t, a.Run([]string{"run", "--verbose=ON", "--color=no"}), nil)
+	expect(t, verbose, true)
+	expect(t, color, false)
+
+	expect(t, a.Run([]string{"run", "--verbose=0"}), nil)
+	expect(t, verbose, false)
+	expect(t, color, true)
+
+	if a.Run([]string{"run", "--verbose=maybe"}) == nil {
+		t.Errorf("expected an error for an invalid boolean value")
+	}
+}
+
+func TestDurationFlagHelpOutput(t *testing.T) {
+	flag := cli.DurationFlag{Name: "timeout, t", Value: 30 * time.Second, Usage: "time to wait", DefaultUnit: time.Second}
+	expect(t, flag.String(), "--timeout, -t '30s'\ttime to wait (default unit: s)")
+
+	flag = cli.DurationFlag{Name: "interval", Value: time.Minute}
+	expect(t, flag.String(), "--interval '1m0s'\t")
+}
+
+func TestParseDuration(t *testing.T) {
+	var timeout, interval time.Duration
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.DurationFlag{Name: "timeout, t", Value: 30 * time.Second, DefaultUnit: time.Second},
+			cli.DurationFlag{Name: "interval"},
+		},
+		Action: func(ctx *cli.Context) {
+			timeout = ctx.Duration("timeout")
+			interval = ctx.GlobalDuration("interval")
+		},
+	}
+
+	expect(t, a.Run([]string{"run"}), nil)
+	expect(t, timeout, 30*time.Second)
+	expect(t, interval, time.Duration(0))
+
+	expect(t, a.Run([]string{"run", "-t", "45", "--interval", "1m30s"}), nil)
+	expect(t, timeout, 45*time.Second)
+	expect(t, interval, 90*time.Second)
+
+	expect(t, a.Run([]string{"run", "--timeout", "1.5", "--interval", "0"}), nil)
+	expect(t, timeout, 1500*time.Millisecond)
+	expect(t, interval, time.Duration(0))
+
+	expect(t, a.Run([]string{"run", "--timeout", "2m"}), nil)
+	expect(t, timeout, 2*time.Minute)
+
+	if a.Run([]string{"run", "--interval", "5"}) == nil {
+		t.Errorf("expected an error for a duration without a unit")
+	}
+
+	for _, value := range []string{"inf", "-Inf", "NaN", "1e300", "9223372037"} {
+		if a.Run([]string{"run", "--timeout", value}) == nil {
+			t.Errorf("expected an error for the duration %q", value)
+		}
+	}
+}
+
+func TestStringFlagExecValues(t *testing.T) {
+	var token string
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "token, t"},
+		},
+		Action: func(ctx *cli.Context) {
+			token = ctx.String("t")
+		},
+	}
+
+	expect(t, a.Run([]string{"run", "--token", "exec:echo secret"}), nil)
+	expect(t, token, "exec:echo secret")
+
+	a.EnableExecFlagValues = true
+	expect(t, a.Run([]string{"run", "--token", "exec:echo  secret "}), nil)
+	expect(t, token, "secret")
+
+	err := a.Run([]string{"run", "--token", "exec:"})
+	expect(t, err.Error(), "Cannot resolve the value of --token: no command given")
+
+	// a resolved default does not count as given
+	var tokenSet bool
+	a.Flags = []cli.Flag{
+		cli.StringFlag{Name: "token, t", Value: "exec:echo default"},
+	}
+	a.Action = func(ctx *cli.Context) {
+		token = ctx.String("t")
+		tokenSet = ctx.IsSet("token")
+	}
+	expect(t, a.Run([]string{"run"}), nil)
+	expect(t, token, "default")
+	expect(t, tokenSet, false)
+}
+
+func TestStringFlagValueResolvers(t *testing.T) {
+	var token string
+	a := cli.NewApp()
+	a.RegisterValueResolver("env", func(ref string) (string, error) {
+		value, ok := os.LookupEnv(ref)
+		if !ok {
+			return "", fmt.Errorf("%s is not set", ref)
+		}
+		return value, nil
+	})
+	a.Commands = []cli.Command{
+		{
+			Name: "deploy",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "token, t"},
+			},
+			Action: func(ctx *cli.Context) {
+				token = ctx.String("t")
+			},
+		},
+	}
+
+	os.Setenv("CLI_TEST_TOKEN", "secret")
+	defer os.Unsetenv("CLI_TEST_TOKEN")
+	expect(t, a.Run([]string{"run", "deploy", "--token", "env://CLI_TEST_TOKEN"}), nil)
+	expect(t, token, "secret")
+
+	expect(t, a.Run([]string{"run", "deploy", "--token", "vault://secret#token"}), nil)
+	expect(t, token, "vault://secret#token")
+
+	err := a.Run([]string{"run", "deploy", "-t", "env://CLI_TEST_MISSING"})
+	expect(t, err.Error(), "Cannot resolve the value of --token: CLI_TEST_MISSING is not set")
+}
+
+func TestStringFlagInterpolation(t *testing.T) {
+	var url string
+	a := cli.App{
+		EnableFlagInterpolation: true,
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "url, u", Value: "https://${host}:${port}/${path}"},
+			cli.StringFlag{Name: "host", Value: "localhost"},
+			cli.IntFlag{Name: "port", Value: 8080},
+			cli.StringFlag{Name: "path", Value: "api"},
+			cli.StringFlag{Name: "a"},
+			cli.StringFlag{Name: "b"},
+		},
+		Action: func(ctx *cli.Context) {
+			url = ctx.String("u")
+		},
+	}
+
+	expect(t, a.Run([]string{"run", "--host", "example.com"}), nil)
+	expect(t, url, "https://example.com:8080/api")
+
+	expect(t, a.Run([]string{"run", "--path", "${host}/v2"}), nil)
+	expect(t, url, "https://localhost:8080/localhost/v2")
+
+	err := a.Run([]string{"run", "-a", "${b}", "-b", "x${a}"})
+	expect(t, err.Error(), "Cannot interpolate the value of -a: circular reference a -> b -> a")
+
+	err = a.Run([]string{"run", "--url", "${missing}"})
+	expect(t, err.Error(), "Cannot interpolate the value of --url: unknown flag 'missing'")
+
+	a.EnableFlagInterpolation = false
+	expect(t, a.Run([]string{"run"}), nil)
+	expect(t, url, "https://${host}:${port}/${path}")
+}
+
+func TestStringFlagInterpolatedDefault(t *testing.T) {
+	var url string
+	a := cli.App{
+		EnableFlagInterpolation: true,
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "url", Value: "http://${host}"},
+			cli.StringFlag{Name: "host", Value: "localhost"},
+			cli.StringFlag{Name: "token"},
+		},
+		Implies: map[string][]string{"url": {"token"}},
+		Action: func(ctx *cli.Context) {
+			url = ctx.String("url")
+		},
+	}
+
+	// the expanded default does not count as given
+	expect(t, a.Run([]string{"run"}), nil)
+	expect(t, url, "http://localhost")
+}
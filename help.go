@@ -1,10 +1,19 @@
 package cli
 
 import (
+	"bytes"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"os/exec"
+	"runtime"
+	"strings"
 	"text/tabwriter"
 	"text/template"
+	"time"
 )
 
 // The text template for the Default help topic.
@@ -14,18 +23,25 @@ var AppHelpTemplate = `NAME:
    {{.Name}} - {{.Usage}}
 
 USAGE:
-   {{.Name}} [global options] command [command options] [arguments...]
+   {{.Name}} [global options] command [command options] [arguments...]{{with .ArgsUsage}}
+   {{$.Name}} [global options] {{.}}{{end}}
 
 VERSION:
    {{.Version}}
 
-COMMANDS:
-   {{range .Commands}}{{.Name}}{{with .ShortName}}, {{.}}{{end}}{{ "\t" }}{{.Usage}}
+{{with .Description}}DESCRIPTION:
+   {{.}}
+
+{{end}}COMMANDS:
+   {{range .Commands}}{{.Name}}{{with .ShortName}}, {{.}}{{end}}{{with .ArgsUsage}} {{.}}{{end}}{{ "\t" }}{{.Usage}}
    {{end}}
 GLOBAL OPTIONS:
-   {{range .Flags}}{{.}}
-   {{end}}
-`
+   {{range .FlagGroups}}{{with .Name}}
+   {{.}}:
+   {{end}}{{range .Flags}}{{.}}
+   {{end}}{{end}}
+{{with .HelpFooter}}{{.}}
+{{end}}`
 
 // The text template for the command help topic.
 // cli.go uses text/template to render templates.
@@ -34,15 +50,22 @@ var CommandHelpTemplate = `NAME:
    {{.Name}} - {{.Usage}}
 
 USAGE:
-   command {{.Name}} [command options] [arguments...]
+   command {{.Name}} [command options] {{if .ArgsUsage}}{{.ArgsUsage}}{{else}}[arguments...]{{end}}
 
 DESCRIPTION:
-   {{.Description}}
+   {{.Description}}{{if .ReadsStdin}}
+   Reads from standard input.{{end}}
 
-OPTIONS:
-   {{range .Flags}}{{.}}
-   {{end}}
-`
+{{with .Version}}VERSION:
+   {{.}}
+
+{{end}}OPTIONS:
+   {{range .FlagGroups}}{{with .Name}}
+   {{.}}:
+   {{end}}{{range .Flags}}{{.}}
+   {{end}}{{end}}
+{{with .HelpFooter}}{{.}}
+{{end}}`
 
 var (
 
@@ -55,13 +78,19 @@ var (
 USAGE:
    {{.Name}} [global options] command [command options] [arguments...]
 
-COMMANDS:
-   {{range .Commands}}{{.Name}}{{with .ShortName}}, {{.}}{{end}}{{ "\t" }}{{.Usage}}
+{{with .Version}}VERSION:
+   {{.}}
+
+{{end}}COMMANDS:
+   {{range .Commands}}{{.Name}}{{with .ShortName}}, {{.}}{{end}}{{with .ArgsUsage}} {{.}}{{end}}{{ "\t" }}{{.Usage}}
    {{end}}
 OPTIONS:
-   {{range .Flags}}{{.}}
-   {{end}}
-`
+   {{range .FlagGroups}}{{with .Name}}
+   {{.}}:
+   {{end}}{{range .Flags}}{{.}}
+   {{end}}{{end}}
+{{with .HelpFooter}}{{.}}
+{{end}}`
 
 	helpCommand = Command{
 		Name:      "help",
@@ -97,12 +126,12 @@ OPTIONS:
 
 // ShowAppHelp prints general help for the application.
 func ShowAppHelp(c *Context) {
-	HelpPrinter(AppHelpTemplate, c.App)
+	c.App.showHelp(HelpPrinter, AppHelpTemplate, c.App.helpData(c))
 }
 
 // DefaultAppComplete prints the list of subcommands as the default app completion method
 func DefaultAppComplete(c *Context) {
-	for _, command := range c.App.Commands {
+	for _, command := range c.App.visibleCommands(c) {
 		fmt.Println(command.Name)
 		if command.ShortName != "" {
 			fmt.Println(command.ShortName)
@@ -112,48 +141,310 @@ func DefaultAppComplete(c *Context) {
 
 // ShowCommandHelp prints help for the given command.
 func ShowCommandHelp(c *Context, command string) {
-	for _, c := range c.App.Commands {
-		if c.HasName(command) {
-			printHelp(CommandHelpTemplate, c)
-			return
+	app := c.App
+	if expansion, ok := app.aliases[command]; ok {
+		fmt.Printf(app.translate("'%s' is an alias for '%s'")+"\n\n", command, strings.Join(expansion, " "))
+		command = expansion[0]
+	}
+	if cmd := app.Command(command); cmd != nil {
+		if command != cmd.Name {
+			fmt.Printf(app.translate("'%s' is an alias for '%s'")+"\n\n", command, cmd.Name)
+		}
+		if c.Command.HasName(cmd.Name) {
+			// only show the flags of the selected mode, if any
+			if selected := cmd.selectedMode(c); selected != -1 {
+				var flags []Flag
+				for _, f := range cmd.Flags {
+					if i := cmd.modeIndex(f); i == -1 || i == selected {
+						flags = append(flags, f)
+					}
+				}
+				cmd.Flags = flags
+				cmd.Modes = cmd.Modes[selected : selected+1]
+			}
 		}
+		app.showHelp(printHelp, CommandHelpTemplate, *cmd)
+		return
 	}
 
 	if c.App.CommandNotFound != nil {
 		c.App.CommandNotFound(c, command)
 	} else {
-		fmt.Printf("No help topic for '%v'\n", command)
+		fmt.Printf(c.App.translate("No help topic for '%v'")+"\n", command)
 	}
 }
 
 // Prints help for the given subcommand
 func ShowSubcommandHelp(c *Context) {
-	HelpPrinter(SubcommandHelpTemplate, c.App)
+	c.App.showHelp(HelpPrinter, SubcommandHelpTemplate, c.App.helpData(c))
 }
 
 // ShowVersion prints the version number of the App.
 func ShowVersion(c *Context) {
-	fmt.Printf("%v version %v\n", c.App.Name, c.App.Version)
+	fmt.Fprintf(c.App.writer(), "%v version %v\n", c.App.Name, c.App.Version)
+}
+
+// ShowCommandVersion prints the version number of the command, or of the App
+// if the command has no version.
+func ShowCommandVersion(c *Context) {
+	version := c.Command.Version
+	if version == "" {
+		version = c.App.Version
+	}
+	fmt.Fprintf(c.App.writer(), "%v %v version %v\n", c.App.Name, c.Command.Name, version)
+}
+
+// ShowVersionJSON prints the name, version and compile time of the App and
+// the version of Go as a JSON object.
+func ShowVersionJSON(c *Context) {
+	info := struct {
+		Name     string    `json:"name"`
+		Version  string    `json:"version"`
+		Compiled time.Time `json:"compiled"`
+		Go       string    `json:"go"`
+	}{c.App.Name, c.App.Version, c.App.Compiled, runtime.Version()}
+	json.NewEncoder(c.App.writer()).Encode(info)
 }
 
 // ShowCompletions prints the lists of commands within a given context
 func ShowCompletions(c *Context) {
 	a := c.App
 	if a != nil && a.BashComplete != nil {
+		a.traceCompletion("completing the arguments of app '%s'", a.Name)
 		a.BashComplete(c)
 	}
 }
 
-// ShowCommandCompletions prints the custom completions for a given command
+// ShowCommandCompletions prints the custom completions for a given command,
+// or the names of its flags if it has no BashComplete function.
 func ShowCommandCompletions(ctx *Context, command string) {
 	c := ctx.App.Command(command)
-	if c != nil && c.BashComplete != nil {
-		c.BashComplete(ctx)
+	if c == nil {
+		ctx.App.traceCompletion("no command '%s'", command)
+		return
+	}
+	if c.BashComplete != nil {
+		ctx.App.traceCompletion("completing the arguments of command '%s' with its BashComplete", c.Name)
+		key := append([]string{ctx.App.Name, c.Name}, ctx.Args()...)
+		ctx.App.completeCached(c.CompletionCacheTTL, key, func() {
+			c.BashComplete(ctx)
+		})
+		return
+	}
+	ctx.App.traceCompletion("completing the flag names of command '%s'", c.Name)
+	var candidates []string
+	for _, f := range c.Flags {
+		eachName(f.getName(), func(name string) {
+			candidates = append(candidates, prefixFor(name)+name)
+		})
+	}
+	printCompletions(ctx, candidates)
+}
+
+// completeFlagValue prints the completions of the value of a flag with a
+// CompleteFunc, if the bash completion flag was given right after the flag and
+// so was parsed as its value. The prefix is empty, as bash filters the
+// completions itself.
+func completeFlagValue(c *Context, flags []Flag) bool {
+	for _, f := range flags {
+		cf, ok := f.(completingFlag)
+		if !ok || cf.completeFunc() == nil {
+			continue
+		}
+
+		completing := false
+		eachName(f.getName(), func(name string) {
+			if ff := c.flagSet.Lookup(name); ff != nil && lastValue(ff) == "--"+BashCompletionFlag.Name {
+				completing = true
+			}
+		})
+		if completing {
+			c.App.traceCompletion("completing the value of flag '%s'", f.getName())
+			key := append([]string{c.App.Name, c.Command.Name, f.getName()}, c.Args()...)
+			c.App.completeCached(c.Command.CompletionCacheTTL, key, func() {
+				printCompletions(c, cf.completeFunc()(c, ""))
+			})
+			return true
+		}
+	}
+	return false
+}
+
+// printCompletions prints the completion candidates, one per line.
+func printCompletions(c *Context, candidates []string) {
+	c.App.traceCompletion("candidates: %s", strings.Join(candidates, " "))
+	for _, candidate := range candidates {
+		fmt.Println(candidate)
+	}
+}
+
+// lastValue returns the value of the flag, or the last value of a slice flag.
+func lastValue(f *flag.Flag) string {
+	if slice, ok := f.Value.(*StringSlice); ok {
+		if len(*slice) == 0 {
+			return ""
+		}
+		return (*slice)[len(*slice)-1]
+	}
+	return f.Value.String()
+}
+
+// FlagGroup is a group of flags that are listed under the same heading in help.
+type FlagGroup struct {
+	// The Group of the flags, empty for the flags without a group
+	Name  string
+	Flags []Flag
+}
+
+// FlagGroups returns the global flags grouped by their Group, for the help
+// templates. The flags without a group come first.
+func (a *App) FlagGroups() []FlagGroup {
+	return groupFlags(a.Flags)
+}
+
+// FlagGroups returns the flags of the command grouped by their Group, for the
+// help templates. The flags without a group come first, and the flags of the
+// Modes of the command last, grouped by mode.
+func (c Command) FlagGroups() []FlagGroup {
+	var flags []Flag
+	modeFlags := make([][]Flag, len(c.Modes))
+	for _, f := range c.Flags {
+		if i := c.modeIndex(f); i != -1 {
+			modeFlags[i] = append(modeFlags[i], f)
+		} else {
+			flags = append(flags, f)
+		}
+	}
+
+	groups := groupFlags(flags)
+	for i, mode := range c.Modes {
+		var others []string
+		for _, other := range c.Modes {
+			if other.Flag != mode.Flag {
+				others = append(others, prefixFor(other.Flag)+other.Flag)
+			}
+		}
+		name := prefixFor(mode.Flag) + mode.Flag + " mode"
+		if len(others) > 0 {
+			name += " (not with " + strings.Join(others, ", ") + ")"
+		}
+		groups = append(groups, FlagGroup{Name: name, Flags: modeFlags[i]})
+	}
+	return groups
+}
+
+// groupFlags groups the flags by their Group, in the order the groups first
+// appear in, after the group of the flags without a group, which is always
+// returned.
+func groupFlags(flags []Flag) []FlagGroup {
+	groups := []FlagGroup{{}}
+	index := map[string]int{"": 0}
+	for _, f := range flags {
+		name := ""
+		if gf, ok := f.(groupedFlag); ok {
+			name = gf.group()
+		}
+		i, ok := index[name]
+		if !ok {
+			i = len(groups)
+			index[name] = i
+			groups = append(groups, FlagGroup{Name: name})
+		}
+		groups[i].Flags = append(groups[i].Flags, f)
 	}
+	return groups
+}
+
+// visibleCommands returns the commands of the app that are listed in help and completions.
+func (a *App) visibleCommands(c *Context) []Command {
+	var commands []Command
+	for _, command := range a.Commands {
+		if command.visible(c) {
+			commands = append(commands, command)
+		}
+	}
+	return commands
+}
+
+// helpData returns a copy of the app that only holds the visible commands, for rendering the help templates.
+func (a *App) helpData(c *Context) *App {
+	app := *a
+	app.Commands = a.visibleCommands(c)
+	return &app
+}
+
+// showHelp prints the help with the given printer. The output of the printer
+// is made compact if CompactHelp is set or the terminal is narrow, and if
+// EnableHelpPager is set and the help does not fit on the terminal, it is
+// shown in a pager.
+func (a *App) showHelp(printer func(string, interface{}), templ string, data interface{}) {
+	compact := a.CompactHelp || (isTerminal(os.Stdout) && terminalWidth() < compactHelpWidth)
+	paged := a.EnableHelpPager && isTerminal(os.Stdout)
+	if !compact && !paged {
+		printer(templ, data)
+		return
+	}
+
+	help, err := renderHelp(printer, templ, data)
+	if err != nil {
+		printer(templ, data)
+		return
+	}
+	if compact {
+		var buf bytes.Buffer
+		writeCompactHelp(&buf, help)
+		help = buf.Bytes()
+	}
+	if !paged || bytes.Count(help, []byte("\n")) < terminalHeight() || !page(help) {
+		os.Stdout.Write(help)
+	}
+}
+
+// renderHelp returns the output of the printer for the given template.
+func renderHelp(printer func(string, interface{}), templ string, data interface{}) ([]byte, error) {
+	f, err := ioutil.TempFile("", "help")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	captureStdout(f, func() { printer(templ, data) })
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(f)
+}
+
+// page shows the given text in $PAGER, less or more, whichever is found
+// first. It returns false if no pager could be run.
+func page(text []byte) bool {
+	pagers := []string{"less -R", "more"}
+	if pager := os.Getenv("PAGER"); pager != "" {
+		pagers = append([]string{pager}, pagers...)
+	}
+
+	for _, pager := range pagers {
+		fields := strings.Fields(pager)
+		path, err := exec.LookPath(fields[0])
+		if err != nil {
+			continue
+		}
+		cmd := exec.Command(path, fields[1:]...)
+		cmd.Stdin = bytes.NewReader(text)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd.Run() == nil
+	}
+	return false
 }
 
 func printHelp(templ string, data interface{}) {
-	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	writeHelp(os.Stdout, templ, data)
+}
+
+func writeHelp(out io.Writer, templ string, data interface{}) {
+	w := tabwriter.NewWriter(out, 0, 8, 1, '\t', 0)
 	t := template.Must(template.New("help").Parse(templ))
 	err := t.Execute(w, data)
 	if err != nil {
@@ -162,8 +453,61 @@ func printHelp(templ string, data interface{}) {
 	w.Flush()
 }
 
+// compactHelpWidth is the terminal width below which help is shown compact.
+const compactHelpWidth = 60
+
+// writeCompactHelp writes the rendered help, but puts the column after the
+// first tab of every line on its own line below, indented further.
+func writeCompactHelp(out io.Writer, help []byte) {
+	for _, line := range strings.SplitAfter(string(help), "\n") {
+		i := strings.Index(line, "\t")
+		if i == -1 {
+			io.WriteString(out, line)
+			continue
+		}
+		name, usage := line[:i], strings.TrimSpace(line[i+1:])
+		indent := name[:len(name)-len(strings.TrimLeft(name, " "))]
+		fmt.Fprintln(out, name)
+		if usage != "" {
+			fmt.Fprintln(out, indent+"    "+usage)
+		}
+	}
+}
+
+// DefaultIsHelp checks if the --help or -h flag is set, the default
+// App.IsHelp.
+func DefaultIsHelp(c *Context) bool {
+	return c.Bool("h") || c.Bool("help")
+}
+
+// DefaultIsVersion checks if the --version flag is set, the default
+// App.IsVersion.
+func DefaultIsVersion(c *Context) bool {
+	return c.Bool("version")
+}
+
+// isHelp checks if help is asked for in the given context.
+func (a *App) isHelp(c *Context) bool {
+	if a.IsHelp == nil {
+		return DefaultIsHelp(c)
+	}
+	return a.IsHelp(c)
+}
+
+// isVersion checks if the version is asked for in the given context.
+func (a *App) isVersion(c *Context) bool {
+	if a.IsVersion == nil {
+		return DefaultIsVersion(c)
+	}
+	return a.IsVersion(c)
+}
+
 func checkVersion(c *Context) bool {
-	if c.GlobalBool("version") {
+	if c.GlobalBool("version-json") {
+		ShowVersionJSON(c)
+		return true
+	}
+	if c.App.isVersion(c) {
 		ShowVersion(c)
 		return true
 	}
@@ -171,7 +515,7 @@ func checkVersion(c *Context) bool {
 }
 
 func checkHelp(c *Context) bool {
-	if c.GlobalBool("h") || c.GlobalBool("help") {
+	if c.App.isHelp(c) {
 		ShowAppHelp(c)
 		return true
 	}
@@ -179,7 +523,7 @@ func checkHelp(c *Context) bool {
 }
 
 func checkCommandHelp(c *Context, name string) bool {
-	if c.Bool("h") || c.Bool("help") {
+	if c.App.isHelp(c) {
 		ShowCommandHelp(c, name)
 		return true
 	}
@@ -187,7 +531,7 @@ func checkCommandHelp(c *Context, name string) bool {
 }
 
 func checkSubcommandHelp(c *Context) bool {
-	if c.GlobalBool("h") || c.GlobalBool("help") {
+	if c.App.isHelp(c) {
 		ShowSubcommandHelp(c)
 		return true
 	}
@@ -195,6 +539,9 @@ func checkSubcommandHelp(c *Context) bool {
 }
 
 func checkCompletions(c *Context) bool {
+	if c.App.EnableBashCompletion && completeFlagValue(c, c.App.Flags) {
+		return true
+	}
 	if c.GlobalBool(BashCompletionFlag.Name) && c.App.EnableBashCompletion {
 		ShowCompletions(c)
 		return true
@@ -203,7 +550,11 @@ func checkCompletions(c *Context) bool {
 }
 
 func checkCommandCompletions(c *Context, name string) bool {
+	if c.App.EnableBashCompletion && completeFlagValue(c, c.Command.Flags) {
+		return true
+	}
 	if c.Bool(BashCompletionFlag.Name) && c.App.EnableBashCompletion {
+		c.App.traceCompletion("matched command '%s'", name)
 		ShowCommandCompletions(c, name)
 		return true
 	}
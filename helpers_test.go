@@ -1,8 +1,11 @@
 package cli_test
 
 import (
+	"bytes"
+	"github.com/codegangsta/cli"
 	"reflect"
 	"testing"
+	"text/template"
 )
 
 type (
@@ -21,6 +24,14 @@ type (
 		name     string
 		expected bool
 	}
+
+	// helpCapture holds the help printed while it captures help, rendered
+	// into the buffer, and the templates and data it was printed with.
+	helpCapture struct {
+		bytes.Buffer
+		templates []string
+		data      []interface{}
+	}
 )
 
 /* Test Helpers */
@@ -35,3 +46,20 @@ func refute(t *testing.T, a interface{}, b interface{}) {
 		t.Errorf("Did not expect %v (type %v) - Got %v (type %v)", b, reflect.TypeOf(b), a, reflect.TypeOf(a))
 	}
 }
+
+// captureHelp replaces cli.HelpPrinter until the end of the test, so that
+// the help that is printed is captured instead.
+func captureHelp(t *testing.T) *helpCapture {
+	oldPrinter := cli.HelpPrinter
+	t.Cleanup(func() {
+		cli.HelpPrinter = oldPrinter
+	})
+
+	capture := &helpCapture{}
+	cli.HelpPrinter = func(templ string, data interface{}) {
+		capture.templates = append(capture.templates, templ)
+		capture.data = append(capture.data, data)
+		template.Must(template.New("help").Parse(templ)).Execute(&capture.Buffer, data)
+	}
+	return capture
+}
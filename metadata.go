@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+)
+
+// metadataVersion is the version of the format printed by the
+// __complete-metadata command. It changes when the format changes in a way
+// that is not backwards compatible.
+const metadataVersion = 1
+
+var metadataCommand = Command{
+	Name:   "__complete-metadata",
+	Usage:  "Prints the commands and flags as JSON for completion tools",
+	Hidden: true,
+	Action: func(c *Context) {
+		metadata := appMetadata{
+			Version:  metadataVersion,
+			Name:     c.App.baseName(),
+			Flags:    flagsMetadata(c.App.Flags),
+			Commands: commandsMetadata(c, c.App.Commands),
+		}
+		json.NewEncoder(c.App.writer()).Encode(metadata)
+	},
+}
+
+// appMetadata describes the commands and flags of an app.
+type appMetadata struct {
+	Version  int               `json:"version"`
+	Name     string            `json:"name"`
+	Flags    []flagMetadata    `json:"flags"`
+	Commands []commandMetadata `json:"commands"`
+}
+
+// commandMetadata describes a command and its subcommands.
+type commandMetadata struct {
+	Name     string            `json:"name"`
+	Aliases  []string          `json:"aliases"`
+	Usage    string            `json:"usage"`
+	Flags    []flagMetadata    `json:"flags"`
+	Commands []commandMetadata `json:"commands"`
+}
+
+// flagMetadata describes a flag.
+type flagMetadata struct {
+	Names      []string `json:"names"`
+	TakesValue bool     `json:"takesValue"`
+	Usage      string   `json:"usage"`
+}
+
+// commandsMetadata describes the commands that are listed in help.
+func commandsMetadata(c *Context, commands []Command) []commandMetadata {
+	metadata := []commandMetadata{}
+	for _, command := range commands {
+		if !command.visible(c) {
+			continue
+		}
+		aliases := []string{}
+		if command.ShortName != "" {
+			aliases = append(aliases, command.ShortName)
+		}
+
+		flags, subcommands := command.Flags, command.Subcommands
+		if command.app != nil {
+			flags, subcommands = command.app.Flags, command.app.Commands
+		}
+		metadata = append(metadata, commandMetadata{
+			Name:     command.Name,
+			Aliases:  aliases,
+			Usage:    command.Usage,
+			Flags:    flagsMetadata(flags),
+			Commands: commandsMetadata(c, subcommands),
+		})
+	}
+	return metadata
+}
+
+// flagsMetadata describes the flags, except the bash completion flag.
+func flagsMetadata(flags []Flag) []flagMetadata {
+	metadata := []flagMetadata{}
+	for _, f := range flags {
+		if f.getName() == BashCompletionFlag.Name {
+			continue
+		}
+
+		set := flag.NewFlagSet("metadata", flag.ContinueOnError)
+		set.SetOutput(ioutil.Discard)
+		f.Apply(set)
+
+		m := flagMetadata{Names: []string{}}
+		eachName(f.getName(), func(name string) {
+			m.Names = append(m.Names, prefixFor(name)+name)
+			if ff := set.Lookup(name); ff != nil {
+				m.TakesValue = !isBoolFlag(ff)
+				m.Usage = ff.Usage
+			}
+		})
+		metadata = append(metadata, m)
+	}
+	return metadata
+}
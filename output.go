@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+)
+
+// Table collects rows of columns and writes them with aligned columns.
+type Table struct {
+	// The maximum number of characters of a line, 0 for no maximum. Longer
+	// lines are cut off and end with "...".
+	Width int
+
+	w       io.Writer
+	headers []string
+	rows    [][]string
+}
+
+// NewTable creates a Table with the given column headers, which writes to the Writer of the App.
+// If the Writer is a terminal, the Width of the table is the width of the terminal.
+func (c *Context) NewTable(headers ...string) *Table {
+	t := &Table{w: c.App.writer(), headers: headers}
+	if f, ok := t.w.(*os.File); ok && isTerminal(f) {
+		t.Width = terminalWidth()
+	}
+	return t
+}
+
+// Append adds a row to the table.
+func (t *Table) Append(columns ...string) {
+	t.rows = append(t.rows, columns)
+}
+
+// Flush writes the headers and the rows appended since the last call to Flush.
+func (t *Table) Flush() error {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	if len(t.headers) > 0 {
+		fmt.Fprintln(w, strings.Join(t.headers, "\t"))
+	}
+	for _, row := range t.rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	t.rows = nil
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		if line == "" {
+			continue
+		}
+		if text := []rune(strings.TrimSuffix(line, "\n")); t.Width > 3 && len(text) > t.Width {
+			line = string(text[:t.Width-3]) + "...\n"
+		}
+		if _, err := io.WriteString(t.w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyTemplate executes the given text/template with data and writes the
+// result, followed by a newline, to the Writer of the App.
+func (c *Context) ApplyTemplate(tmpl string, data interface{}) error {
+	t, err := template.New("format").Parse(tmpl)
+	if err != nil {
+		return fmt.Errorf("Invalid template: %v", err)
+	}
+	w := c.App.writer()
+	if err := t.Execute(w, data); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w)
+	return err
+}
+
+// EmitRecord writes v as JSON on a line of its own to the Writer of the App,
+// for commands that stream records as newline-delimited JSON. The record is
+// written right away, even if BufferedOutput is set.
+func (c *Context) EmitRecord(v interface{}) error {
+	if err := json.NewEncoder(c.App.writer()).Encode(v); err != nil {
+		return err
+	}
+	if c.App.buffer != nil {
+		return c.App.buffer.Flush()
+	}
+	return nil
+}
+
+// redirectOutput makes the file at path the Writer of the App. The returned
+// function restores the previous Writer and closes the file. An empty path or
+// "-" keeps the Writer.
+func (a *App) redirectOutput(path string) (func() error, error) {
+	if path == "" || path == "-" {
+		return func() error { return nil }, nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := a.Writer
+	a.Writer = f
+	return func() error {
+		a.Writer = w
+		return f.Close()
+	}, nil
+}
+
+// bufferOutput wraps the Writer of the App in a bufio.Writer. The returned
+// function flushes it and restores the previous Writer.
+func (a *App) bufferOutput() func() error {
+	w := a.Writer
+	a.buffer = bufio.NewWriter(a.writer())
+	a.Writer = a.buffer
+	return func() error {
+		b := a.buffer
+		a.Writer = w
+		a.buffer = nil
+		return b.Flush()
+	}
+}
@@ -0,0 +1,117 @@
+package cli_test
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContext_NewTable(t *testing.T) {
+	var buf bytes.Buffer
+	app := cli.NewApp()
+	app.Writer = &buf
+	set := flag.NewFlagSet("test", 0)
+	c := cli.NewContext(app, set, set)
+
+	table := c.NewTable("NAME", "STATUS")
+	table.Append("web", "running")
+	table.Append("database", "stopped")
+	err := table.Flush()
+
+	expect(t, err, nil)
+	expect(t, buf.String(), "NAME      STATUS\nweb       running\ndatabase  stopped\n")
+}
+
+func TestContext_NewTableWidth(t *testing.T) {
+	var buf bytes.Buffer
+	app := cli.NewApp()
+	app.Writer = &buf
+	set := flag.NewFlagSet("test", 0)
+	c := cli.NewContext(app, set, set)
+
+	table := c.NewTable("NAME", "DESCRIPTION")
+	expect(t, table.Width, 0)
+	table.Width = 20
+	table.Append("web", "the frontend server")
+	table.Append("db", "postgres")
+	err := table.Flush()
+
+	expect(t, err, nil)
+	expect(t, buf.String(), "NAME  DESCRIPTION\nweb   the fronten...\ndb    postgres\n")
+}
+
+func TestContext_ApplyTemplate(t *testing.T) {
+	var buf bytes.Buffer
+	app := cli.NewApp()
+	app.Writer = &buf
+	set := flag.NewFlagSet("test", 0)
+	c := cli.NewContext(app, set, set)
+
+	data := struct{ Name, Status string }{"web", "running"}
+	err := c.ApplyTemplate("{{.Name}} {{.Status}}", data)
+	expect(t, err, nil)
+	expect(t, buf.String(), "web running\n")
+
+	err = c.ApplyTemplate("{{.Name", data)
+	refute(t, err, nil)
+}
+
+func TestContext_EmitRecord(t *testing.T) {
+	var buf bytes.Buffer
+	var streamed []string
+	app := cli.NewApp()
+	app.Writer = &buf
+	app.BufferedOutput = true
+	app.Action = func(c *cli.Context) {
+		for _, name := range []string{"web", "database"} {
+			err := c.EmitRecord(map[string]string{"name": name})
+			expect(t, err, nil)
+			streamed = append(streamed, buf.String())
+		}
+		refute(t, c.EmitRecord(func() {}), nil)
+	}
+
+	app.Run([]string{"command"})
+	expect(t, streamed[0], "{\"name\":\"web\"}\n")
+	expect(t, buf.String(), "{\"name\":\"web\"}\n{\"name\":\"database\"}\n")
+}
+
+func TestApp_OutputFileFlag(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	expect(t, err, nil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.txt")
+
+	var buf bytes.Buffer
+	app := cli.NewApp()
+	app.Writer = &buf
+	app.EnableOutputFileFlag = true
+	app.After = func(c *cli.Context) error {
+		fmt.Fprintln(c.App.Writer, "done")
+		return nil
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "generate",
+			Action: func(c *cli.Context) {
+				fmt.Fprintln(c.App.Writer, "generated")
+			},
+		},
+	}
+
+	err = app.Run([]string{"command", "-O", path, "generate"})
+	expect(t, err, nil)
+	content, err := ioutil.ReadFile(path)
+	expect(t, err, nil)
+	expect(t, string(content), "generated\ndone\n")
+	expect(t, buf.String(), "")
+
+	err = app.Run([]string{"command", "--output-file", "-", "generate"})
+	expect(t, err, nil)
+	expect(t, buf.String(), "generated\ndone\n")
+}
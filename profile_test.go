@@ -0,0 +1,40 @@
+package cli_test
+
+import (
+	"github.com/codegangsta/cli"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApp_ProfilingFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli-profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cpu := filepath.Join(dir, "cpu.prof")
+	mem := filepath.Join(dir, "mem.prof")
+	afterRun := false
+	app := cli.NewApp()
+	app.EnableProfilingFlags = true
+	app.Action = func(c *cli.Context) {}
+	app.After = func(c *cli.Context) error {
+		// the heap profile is written after the After hook
+		_, err := os.Stat(mem)
+		expect(t, os.IsNotExist(err), true)
+		afterRun = true
+		return nil
+	}
+
+	err = app.Run([]string{"command", "--cpuprofile", cpu, "--memprofile", mem})
+	expect(t, err, nil)
+	expect(t, afterRun, true)
+	for _, path := range []string{cpu, mem} {
+		info, err := os.Stat(path)
+		expect(t, err, nil)
+		expect(t, info.Size() > 0, true)
+	}
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// progressInterval is how often progress is logged when the ErrWriter is not a terminal.
+const progressInterval = 5 * time.Second
+
+// spinnerFrames are shown in turn in front of the status line.
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+// Progress reports the progress of a long running command on the ErrWriter
+// of the App.
+type Progress struct {
+	mu     sync.Mutex
+	app    *App
+	w      io.Writer
+	out    io.Writer
+	tty    bool
+	drawn  bool
+	frame  int
+	logged time.Time
+}
+
+// Progress creates a Progress for the App. If the ErrWriter is a terminal and
+// the App is not in batch mode, the progress is shown in a status line that
+// is updated in place. The Writer of the App is replaced until Done is called,
+// so that output written to it clears the status line first. Otherwise the
+// progress is logged at most every five seconds.
+func (c *Context) Progress() *Progress {
+	p := &Progress{app: c.App, w: c.App.errWriter()}
+	if f, ok := p.w.(*os.File); ok && isTerminal(f) && !c.App.BatchMode {
+		p.tty = true
+		p.out = c.App.writer()
+		c.App.Writer = progressWriter{p}
+	}
+	return p
+}
+
+// Update reports the given status. If total is positive, the percentage of
+// done out of total is shown too.
+func (p *Progress) Update(done, total int, status string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if total > 0 {
+		status = fmt.Sprintf("%s %d%%", status, done*100/total)
+	}
+	if p.tty {
+		fmt.Fprintf(p.w, "\r\033[K%s %s", spinnerFrames[p.frame%len(spinnerFrames)], status)
+		p.frame++
+		p.drawn = true
+		return
+	}
+	if now := time.Now(); now.Sub(p.logged) >= progressInterval {
+		fmt.Fprintln(p.w, status)
+		p.logged = now
+	}
+}
+
+// Done clears the status line, prints the final status and restores the
+// Writer of the App.
+func (p *Progress) Done(status string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.tty {
+		p.clear()
+		p.app.Writer = p.out
+		p.tty = false
+	}
+	fmt.Fprintln(p.w, status)
+}
+
+// clear removes the status line from the terminal.
+func (p *Progress) clear() {
+	if p.drawn {
+		fmt.Fprint(p.w, "\r\033[K")
+		p.drawn = false
+	}
+}
+
+// progressWriter clears the status line of a Progress before writing to the
+// Writer the App had when the Progress was created.
+type progressWriter struct {
+	p *Progress
+}
+
+func (w progressWriter) Write(b []byte) (int, error) {
+	w.p.mu.Lock()
+	defer w.p.mu.Unlock()
+
+	w.p.clear()
+	return w.p.out.Write(b)
+}
@@ -0,0 +1,23 @@
+package cli_test
+
+import (
+	"bytes"
+	"flag"
+	"github.com/codegangsta/cli"
+	"testing"
+)
+
+func TestContext_Progress(t *testing.T) {
+	var buf bytes.Buffer
+	app := cli.NewApp()
+	app.ErrWriter = &buf
+	set := flag.NewFlagSet("test", 0)
+	c := cli.NewContext(app, set, set)
+
+	p := c.Progress()
+	p.Update(1, 4, "copying")
+	p.Update(2, 4, "copying")
+	p.Done("copied 4 files")
+
+	expect(t, buf.String(), "copying 25%\ncopied 4 files\n")
+}
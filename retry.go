@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Retry calls fn until it succeeds, at most the given number of attempts,
+// waiting backoff after the first failure and twice as long after each
+// next one. fn is called at least once. If all attempts fail, the last error
+// is returned wrapped with the number of attempts.
+func (c *Context) Retry(attempts int, backoff time.Duration, fn func() error) error {
+	return c.RetryContext(context.Background(), attempts, backoff, fn)
+}
+
+// RetryContext is like Retry, but stops waiting and returns the error of ctx,
+// wrapped with the number of attempts made, once ctx is done.
+func (c *Context) RetryContext(ctx context.Context, attempts int, backoff time.Duration, fn func() error) error {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if attempt == attempts {
+			break
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("Cancelled after %d attempts: %w", attempt, ctx.Err())
+		}
+		backoff *= 2
+	}
+	return fmt.Errorf("Failed after %d attempts: %w", attempts, err)
+}
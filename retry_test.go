@@ -0,0 +1,60 @@
+package cli_test
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"github.com/codegangsta/cli"
+	"testing"
+	"time"
+)
+
+func TestContext_Retry(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	c := cli.NewContext(nil, set, set)
+	unavailable := errors.New("service unavailable")
+
+	calls := 0
+	err := c.Retry(3, time.Millisecond, func() error {
+		calls++
+		if calls < 3 {
+			return unavailable
+		}
+		return nil
+	})
+	expect(t, err, nil)
+	expect(t, calls, 3)
+
+	calls = 0
+	err = c.Retry(2, time.Millisecond, func() error {
+		calls++
+		return unavailable
+	})
+	expect(t, calls, 2)
+	expect(t, err.Error(), "Failed after 2 attempts: service unavailable")
+	expect(t, errors.Is(err, unavailable), true)
+
+	calls = 0
+	err = c.Retry(0, time.Millisecond, func() error {
+		calls++
+		return unavailable
+	})
+	expect(t, calls, 1)
+	expect(t, err.Error(), "Failed after 1 attempts: service unavailable")
+}
+
+func TestContext_RetryContext(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	c := cli.NewContext(nil, set, set)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := 0
+	err := c.RetryContext(ctx, 5, time.Hour, func() error {
+		calls++
+		cancel()
+		return errors.New("service unavailable")
+	})
+	expect(t, calls, 1)
+	expect(t, err.Error(), "Cancelled after 1 attempts: context canceled")
+	expect(t, errors.Is(err, context.Canceled), true)
+}
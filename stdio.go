@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OpenArg opens the file named by the nth argument for reading. If the
+// argument is "-", the Reader of the App is returned, which is not closed by
+// Close.
+func (c *Context) OpenArg(n int) (io.ReadCloser, error) {
+	args := c.Args()
+	if n < 0 || n >= len(args) {
+		return nil, fmt.Errorf("No argument at position %d", n)
+	}
+	if args[n] == "-" {
+		return ioutil.NopCloser(c.App.reader()), nil
+	}
+	return os.Open(args[n])
+}
+
+// CreateArg creates or truncates the file named by the nth argument for
+// writing. If the argument is "-", the Writer of the App is returned, which
+// is not closed by Close.
+func (c *Context) CreateArg(n int) (io.WriteCloser, error) {
+	args := c.Args()
+	if n < 0 || n >= len(args) {
+		return nil, fmt.Errorf("No argument at position %d", n)
+	}
+	if args[n] == "-" {
+		return nopWriteCloser{c.App.writer()}, nil
+	}
+	return os.Create(args[n])
+}
+
+// ReadMultiline reads lines from the Reader of the App until the end of the
+// input or a line that is the sentinel, and returns the lines before it. An
+// empty sentinel only ends at the end of the input. When the input comes
+// from a terminal, a note on how to end the input is printed to ErrWriter,
+// or an error is returned in BatchMode, as nobody would type the input.
+func (c *Context) ReadMultiline(sentinel string) (string, error) {
+	r := c.App.reader()
+	if f, ok := r.(*os.File); ok && isTerminal(f) {
+		if c.App.BatchMode {
+			return "", errors.New(c.App.translate("Cannot read input from the terminal in batch mode"))
+		}
+		if sentinel == "" {
+			fmt.Fprintln(c.App.errWriter(), c.App.translate("End the input with Ctrl-D."))
+		} else {
+			fmt.Fprintf(c.App.errWriter(), c.App.translate("End the input with a line containing only '%s', or with Ctrl-D.")+"\n", sentinel)
+		}
+	}
+
+	var text strings.Builder
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if sentinel != "" && strings.TrimRight(line, "\r\n") == sentinel {
+			return text.String(), nil
+		}
+		text.WriteString(line)
+		if err == io.EOF {
+			return text.String(), nil
+		}
+		if err != nil {
+			return text.String(), err
+		}
+	}
+}
+
+// GlobArgs expands each argument as a glob pattern, for shells that do not
+// expand them, and returns the matching paths without duplicates. Arguments
+// that match nothing are kept as they are if keepUnmatched is true, and left
+// out otherwise. An error is returned for a malformed pattern.
+func (c *Context) GlobArgs(keepUnmatched bool) ([]string, error) {
+	paths := []string{}
+	seen := make(map[string]bool)
+	for _, arg := range c.Args() {
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pattern '%s': %v", arg, err)
+		}
+		if len(matches) == 0 && keepUnmatched {
+			matches = []string{arg}
+		}
+		for _, path := range matches {
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths, nil
+}
+
+// nopWriteCloser is a Writer with a Close method that does nothing.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
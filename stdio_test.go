@@ -0,0 +1,149 @@
+package cli_test
+
+import (
+	"bytes"
+	"flag"
+	"github.com/codegangsta/cli"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestContext_OpenArg(t *testing.T) {
+	file, err := ioutil.TempFile("", "cli-openarg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("hello")
+	file.Close()
+
+	set := flag.NewFlagSet("test", 0)
+	set.Parse([]string{file.Name(), "-"})
+	c := cli.NewContext(nil, set, set)
+
+	r, err := c.OpenArg(0)
+	expect(t, err, nil)
+	data, _ := ioutil.ReadAll(r)
+	r.Close()
+	expect(t, string(data), "hello")
+
+	r, err = c.OpenArg(1)
+	expect(t, err, nil)
+	r.Close()
+	_, err = os.Stdin.Stat()
+	expect(t, err, nil)
+
+	_, err = c.OpenArg(2)
+	expect(t, err.Error(), "No argument at position 2")
+}
+
+func TestContext_CreateArg(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli-createarg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.txt")
+
+	var buf bytes.Buffer
+	app := cli.NewApp()
+	app.Writer = &buf
+	set := flag.NewFlagSet("test", 0)
+	set.Parse([]string{"-", path})
+	c := cli.NewContext(app, set, set)
+
+	w, err := c.CreateArg(1)
+	expect(t, err, nil)
+	w.Write([]byte("hello"))
+	expect(t, w.Close(), nil)
+	data, _ := ioutil.ReadFile(path)
+	expect(t, string(data), "hello")
+
+	w, err = c.CreateArg(0)
+	expect(t, err, nil)
+	w.Write([]byte("to stdout"))
+	expect(t, w.Close(), nil)
+	expect(t, buf.String(), "to stdout")
+
+	_, err = c.CreateArg(2)
+	expect(t, err.Error(), "No argument at position 2")
+}
+
+func TestContext_GlobArgs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli-globargs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.txt", "b.txt", "c.md"} {
+		ioutil.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+
+	set := flag.NewFlagSet("test", 0)
+	set.Parse([]string{filepath.Join(dir, "*.txt"), filepath.Join(dir, "a.*"), filepath.Join(dir, "*.go")})
+	c := cli.NewContext(nil, set, set)
+
+	paths, err := c.GlobArgs(true)
+	expect(t, err, nil)
+	expect(t, strings.Join(paths, ","), strings.Join([]string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt"), filepath.Join(dir, "*.go")}, ","))
+
+	paths, err = c.GlobArgs(false)
+	expect(t, err, nil)
+	expect(t, strings.Join(paths, ","), filepath.Join(dir, "a.txt")+","+filepath.Join(dir, "b.txt"))
+
+	set = flag.NewFlagSet("test", 0)
+	set.Parse([]string{"[a"})
+	c = cli.NewContext(nil, set, set)
+	_, err = c.GlobArgs(true)
+	expect(t, err.Error(), "Invalid pattern '[a': syntax error in pattern")
+}
+
+func TestContext_ReadMultiline(t *testing.T) {
+	app := cli.NewApp()
+	set := flag.NewFlagSet("test", 0)
+	set.Parse([]string{"-"})
+	c := cli.NewContext(app, set, set)
+
+	app.Reader = strings.NewReader("Fix the parser\n\nIt crashed on empty input.\n.\nnot read\n")
+	text, err := c.ReadMultiline(".")
+	expect(t, err, nil)
+	expect(t, text, "Fix the parser\n\nIt crashed on empty input.\n")
+
+	app.Reader = strings.NewReader("first\nlast")
+	text, err = c.ReadMultiline("")
+	expect(t, err, nil)
+	expect(t, text, "first\nlast")
+
+	app.Reader = strings.NewReader("piped")
+	r, err := c.OpenArg(0)
+	expect(t, err, nil)
+	data, _ := ioutil.ReadAll(r)
+	expect(t, string(data), "piped")
+}
+
+func TestContext_ReadMultilineBatchMode(t *testing.T) {
+	// the master side of a pseudo terminal is a terminal nobody types into
+	terminal, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skip("no pseudo terminal:", err)
+	}
+	defer terminal.Close()
+
+	app := cli.NewApp()
+	app.BatchMode = true
+	app.Reader = terminal
+	set := flag.NewFlagSet("test", 0)
+	c := cli.NewContext(app, set, set)
+
+	_, err = c.ReadMultiline(".")
+	expect(t, err.Error(), "Cannot read input from the terminal in batch mode")
+
+	// piped input is read as usual
+	app.Reader = strings.NewReader("piped\n")
+	text, err := c.ReadMultiline(".")
+	expect(t, err, nil)
+	expect(t, text, "piped\n")
+}
@@ -0,0 +1,244 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// BuildFlags creates a flag for every exported field of the given struct, or
+// pointer to a struct, using the current field values as defaults. The flag
+// name is taken from the cli tag, e.g. `cli:"port, p"`, or else from the
+// kebab-case field name, and fields tagged `cli:"-"` are skipped. The usage
+// is taken from the usage tag. If the environment variable named by the env
+// tag, e.g. `env:"PORT"`, is set, its value is the default instead, with
+// slices given as comma separated values. Fields tagged `required:"true"`
+// must be set, which Unmarshal checks. Fields must be of type string, int,
+// float64, bool, []string or []int, otherwise an error is returned.
+func BuildFlags(v interface{}) ([]Flag, error) {
+	if reflect.Indirect(reflect.ValueOf(v)).Kind() != reflect.Struct {
+		return nil, fmt.Errorf("BuildFlags needs a struct, got %T", v)
+	}
+
+	var flags []Flag
+	err := eachField(v, func(name string, field reflect.StructField, value reflect.Value) error {
+		if env := field.Tag.Get("env"); env != "" && os.Getenv(env) != "" {
+			value = reflect.New(field.Type).Elem()
+			if err := setField(value, os.Getenv(env)); err != nil {
+				return fmt.Errorf("Invalid value %q of $%s for field %s: %v", os.Getenv(env), env, field.Name, err)
+			}
+		}
+
+		usage := field.Tag.Get("usage")
+		switch value := value.Interface().(type) {
+		case string:
+			flags = append(flags, StringFlag{Name: name, Value: value, Usage: usage})
+		case int:
+			flags = append(flags, IntFlag{Name: name, Value: value, Usage: usage})
+		case float64:
+			flags = append(flags, Float64Flag{Name: name, Value: value, Usage: usage})
+		case bool:
+			if value {
+				flags = append(flags, BoolTFlag{Name: name, Usage: usage})
+			} else {
+				flags = append(flags, BoolFlag{Name: name, Usage: usage})
+			}
+		case []string:
+			slice := StringSlice(append([]string(nil), value...))
+			flags = append(flags, StringSliceFlag{Name: name, Value: &slice, Usage: usage})
+		case []int:
+			slice := IntSlice(append([]int(nil), value...))
+			flags = append(flags, IntSliceFlag{Name: name, Value: &slice, Usage: usage})
+		default:
+			return unsupportedField(field)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return flags, nil
+}
+
+// Unmarshal sets the fields of the struct v points to from the local flags
+// of the context, which are expected to be created by BuildFlags. An error
+// is returned if a flag is missing or a required flag is not set.
+func (c *Context) Unmarshal(v interface{}) error {
+	if value := reflect.ValueOf(v); value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return errors.New("Unmarshal needs a pointer to a struct")
+	}
+
+	return eachField(v, func(name string, field reflect.StructField, value reflect.Value) error {
+		name = strings.TrimSpace(strings.Split(name, ",")[0])
+		if c.flagSet.Lookup(name) == nil {
+			return fmt.Errorf("No flag %s%s for field %s", prefixFor(name), name, field.Name)
+		}
+		if isRequired(field) && !c.IsSet(name) && os.Getenv(field.Tag.Get("env")) == "" {
+			return fmt.Errorf("%s%s is required", prefixFor(name), name)
+		}
+
+		switch value.Interface().(type) {
+		case string:
+			value.SetString(c.String(name))
+		case int:
+			value.SetInt(int64(c.Int(name)))
+		case float64:
+			value.SetFloat(c.Float64(name))
+		case bool:
+			value.SetBool(c.Bool(name))
+		case []string:
+			value.Set(reflect.ValueOf(c.StringSlice(name)))
+		case []int:
+			value.Set(reflect.ValueOf(c.IntSlice(name)))
+		default:
+			return unsupportedField(field)
+		}
+		return nil
+	})
+}
+
+// SchemaFor returns a JSON Schema of the config files that set the flags
+// BuildFlags creates for the given struct, or pointer to a struct. The
+// properties are named like the flags and have the current field values as
+// defaults, and the fields tagged `required:"true"` are required.
+func SchemaFor(v interface{}) ([]byte, error) {
+	if reflect.Indirect(reflect.ValueOf(v)).Kind() != reflect.Struct {
+		return nil, fmt.Errorf("SchemaFor needs a struct, got %T", v)
+	}
+
+	properties := make(map[string]interface{})
+	var required []string
+	err := eachField(v, func(name string, field reflect.StructField, value reflect.Value) error {
+		var schemaType, itemType string
+		switch value.Interface().(type) {
+		case string:
+			schemaType = "string"
+		case int:
+			schemaType = "integer"
+		case float64:
+			schemaType = "number"
+		case bool:
+			schemaType = "boolean"
+		case []string:
+			schemaType, itemType = "array", "string"
+		case []int:
+			schemaType, itemType = "array", "integer"
+		default:
+			return unsupportedField(field)
+		}
+
+		name = strings.TrimSpace(strings.Split(name, ",")[0])
+		property := map[string]interface{}{"type": schemaType}
+		if value.Kind() != reflect.Slice || !value.IsNil() {
+			property["default"] = value.Interface()
+		}
+		if itemType != "" {
+			property["items"] = map[string]string{"type": itemType}
+		}
+		if usage := field.Tag.Get("usage"); usage != "" {
+			property["description"] = usage
+		}
+		if isRequired(field) {
+			required = append(required, name)
+		}
+		properties[name] = property
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	schema := map[string]interface{}{
+		"$schema":              "http://json-schema.org/draft-07/schema#",
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// eachField calls fn with the flag name, the field and the value of every
+// exported field of the given struct, or pointer to a struct, and returns the
+// first error fn returns.
+func eachField(v interface{}, fn func(string, reflect.StructField, reflect.Value) error) error {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		return fmt.Errorf("Expected a struct, got %T", v)
+	}
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Tag.Get("cli")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = kebabCase(field.Name)
+		}
+		if err := fn(name, field, value.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setField sets the given string, int, float64, bool, []string or []int
+// value from its text, with slices given as comma separated values.
+func setField(value reflect.Value, text string) error {
+	switch value.Interface().(type) {
+	case string:
+		value.SetString(text)
+	case int:
+		i, err := strconv.Atoi(text)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(i))
+	case float64:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return err
+		}
+		value.SetFloat(f)
+	case bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case []string:
+		value.Set(reflect.ValueOf(strings.Split(text, ",")))
+	case []int:
+		var ints []int
+		for _, part := range strings.Split(text, ",") {
+			i, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				return err
+			}
+			ints = append(ints, i)
+		}
+		value.Set(reflect.ValueOf(ints))
+	}
+	return nil
+}
+
+// isRequired checks if the field is tagged `required:"true"`.
+func isRequired(field reflect.StructField) bool {
+	required, _ := strconv.ParseBool(field.Tag.Get("required"))
+	return required
+}
+
+// unsupportedField returns the error for a field of a type without a flag.
+func unsupportedField(field reflect.StructField) error {
+	return fmt.Errorf("Unsupported type %v of field %s", field.Type, field.Name)
+}
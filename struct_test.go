@@ -0,0 +1,166 @@
+package cli_test
+
+import (
+	"github.com/codegangsta/cli"
+	"os"
+	"reflect"
+	"testing"
+)
+
+type serverConfig struct {
+	Host     string   `usage:"host to listen on"`
+	Port     int      `cli:"port, p" usage:"port to listen on"`
+	Ratio    float64  `cli:"ratio"`
+	Debug    bool     `cli:"debug"`
+	Colors   bool     `cli:"colors"`
+	Origins  []string `cli:"origin"`
+	Internal string   `cli:"-"`
+}
+
+func TestBuildFlags(t *testing.T) {
+	flags, err := cli.BuildFlags(serverConfig{Host: "localhost", Port: 80, Colors: true})
+	expect(t, err, nil)
+
+	var output []string
+	for _, f := range flags {
+		output = append(output, f.String())
+	}
+	expect(t, len(flags), 6)
+	expect(t, output[0], "--host 'localhost'\thost to listen on")
+	expect(t, output[1], "--port, -p '80'\tport to listen on")
+	expect(t, output[4], "--colors\t")
+
+	_, err = cli.BuildFlags(struct{ Timeout chan int }{})
+	expect(t, err.Error(), "Unsupported type chan int of field Timeout")
+
+	_, err = cli.BuildFlags("serverConfig")
+	expect(t, err.Error(), "BuildFlags needs a struct, got string")
+}
+
+func TestBuildFlagsEnv(t *testing.T) {
+	type config struct {
+		Port    int      `cli:"port" env:"CLI_TEST_PORT"`
+		Origins []string `cli:"origin" env:"CLI_TEST_ORIGINS"`
+	}
+
+	os.Setenv("CLI_TEST_PORT", "8080")
+	os.Setenv("CLI_TEST_ORIGINS", "a,b")
+	defer os.Unsetenv("CLI_TEST_PORT")
+	defer os.Unsetenv("CLI_TEST_ORIGINS")
+
+	flags, err := cli.BuildFlags(config{Port: 80})
+	expect(t, err, nil)
+	expect(t, flags[0].String(), "--port '8080'\t")
+	expect(t, flags[1].String(), "--origin '--origin option --origin option'\t(default: a,b)")
+
+	os.Setenv("CLI_TEST_PORT", "http")
+	_, err = cli.BuildFlags(config{Port: 80})
+	expect(t, err.Error(), `Invalid value "http" of $CLI_TEST_PORT for field Port: strconv.Atoi: parsing "http": invalid syntax`)
+}
+
+func TestContext_Unmarshal(t *testing.T) {
+	defaults := serverConfig{Host: "localhost", Port: 80, Colors: true}
+	var config serverConfig
+	flags, err := cli.BuildFlags(&defaults)
+	expect(t, err, nil)
+
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{
+			Name:  "serve",
+			Flags: flags,
+			Action: func(c *cli.Context) {
+				expect(t, c.Unmarshal(&config), nil)
+			},
+		},
+	}
+
+	err = app.Run([]string{"command", "serve", "-p", "8080", "--debug", "--origin", "a", "--origin", "b"})
+	expect(t, err, nil)
+	expect(t, config.Host, "localhost")
+	expect(t, config.Port, 8080)
+	expect(t, config.Debug, true)
+	expect(t, config.Colors, true)
+	expect(t, reflect.DeepEqual(config.Origins, []string{"a", "b"}), true)
+}
+
+func TestContext_UnmarshalRequired(t *testing.T) {
+	type config struct {
+		Token string `cli:"token" env:"CLI_TEST_TOKEN" required:"true"`
+	}
+
+	var config1 config
+	var unmarshalErr error
+	flags, err := cli.BuildFlags(config1)
+	expect(t, err, nil)
+
+	app := cli.NewApp()
+	app.Flags = flags
+	app.Action = func(c *cli.Context) {
+		unmarshalErr = c.Unmarshal(&config1)
+	}
+
+	app.Run([]string{"command"})
+	expect(t, unmarshalErr.Error(), "--token is required")
+
+	app.Run([]string{"command", "--token", "secret"})
+	expect(t, unmarshalErr, nil)
+	expect(t, config1.Token, "secret")
+
+	os.Setenv("CLI_TEST_TOKEN", "from-env")
+	defer os.Unsetenv("CLI_TEST_TOKEN")
+	app.Flags, err = cli.BuildFlags(config{})
+	expect(t, err, nil)
+	app.Run([]string{"command"})
+	expect(t, unmarshalErr, nil)
+	expect(t, config1.Token, "from-env")
+}
+
+func TestContext_UnmarshalErrors(t *testing.T) {
+	var errs []error
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{cli.StringFlag{Name: "host"}}
+	app.Action = func(c *cli.Context) {
+		var config serverConfig
+		errs = append(errs, c.Unmarshal(config))
+		errs = append(errs, c.Unmarshal(&config))
+		errs = append(errs, c.Unmarshal(&struct{ Host chan int }{}))
+	}
+
+	app.Run([]string{"command"})
+	expect(t, errs[0].Error(), "Unmarshal needs a pointer to a struct")
+	expect(t, errs[1].Error(), "No flag --port for field Port")
+	expect(t, errs[2].Error(), "Unsupported type chan int of field Host")
+}
+
+func TestSchemaFor(t *testing.T) {
+	schema, err := cli.SchemaFor(struct {
+		Port    int      `cli:"port, p" usage:"port to listen on" required:"true"`
+		Origins []string `cli:"origin"`
+	}{Port: 80})
+	expect(t, err, nil)
+	expect(t, string(schema), `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "additionalProperties": false,
+  "properties": {
+    "origin": {
+      "items": {
+        "type": "string"
+      },
+      "type": "array"
+    },
+    "port": {
+      "default": 80,
+      "description": "port to listen on",
+      "type": "integer"
+    }
+  },
+  "required": [
+    "port"
+  ],
+  "type": "object"
+}`)
+
+	_, err = cli.SchemaFor(struct{ Timeout chan int }{})
+	expect(t, err.Error(), "Unsupported type chan int of field Timeout")
+}
@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"os"
+	"strconv"
+)
+
+// terminalHeight returns the number of lines of the terminal stdout is
+// connected to, or else as given by $LINES, or 24 if it is unknown.
+func terminalHeight() int {
+	if lines, _, ok := windowSize(os.Stdout); ok && lines > 0 {
+		return lines
+	}
+	if lines, err := strconv.Atoi(os.Getenv("LINES")); err == nil && lines > 0 {
+		return lines
+	}
+	return 24
+}
+
+// terminalWidth returns the number of columns of the terminal stdout is
+// connected to, or else as given by $COLUMNS, or 80 if it is unknown.
+func terminalWidth() int {
+	if _, columns, ok := windowSize(os.Stdout); ok && columns > 0 {
+		return columns
+	}
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	return 80
+}
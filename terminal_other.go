@@ -0,0 +1,23 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package cli
+
+import (
+	"os"
+)
+
+// windowSize returns the number of lines and columns of the terminal f is
+// connected to. It is not supported on this platform, so ok is false.
+func windowSize(f *os.File) (lines, columns int, ok bool) {
+	return 0, 0, false
+}
+
+// isTerminal checks if the given file is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
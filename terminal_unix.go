@@ -0,0 +1,32 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package cli
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// winsize is the struct the TIOCGWINSZ ioctl fills in.
+type winsize struct {
+	rows, cols, xpixel, ypixel uint16
+}
+
+// windowSize returns the number of lines and columns of the terminal f is
+// connected to. ok is false if f is not a terminal.
+func windowSize(f *os.File) (lines, columns int, ok bool) {
+	var ws winsize
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return 0, 0, false
+	}
+	return int(ws.rows), int(ws.cols), true
+}
+
+// isTerminal checks if the given file is a terminal.
+func isTerminal(f *os.File) bool {
+	_, _, ok := windowSize(f)
+	return ok
+}